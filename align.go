@@ -0,0 +1,94 @@
+package graceful
+
+import "time"
+
+const day = 24 * time.Hour
+
+type alignment struct {
+	epoch time.Time
+	loc   *time.Location
+}
+
+// next returns the first boundary strictly after t. Intervals of whole days
+// are counted in calendar days of the location, and intervals that divide a
+// day in wall-clock time of the location, so ticks stay on the same local
+// times across DST transitions. Other intervals are counted in absolute time
+// from the epoch.
+func (a *alignment) next(t time.Time, interval time.Duration) time.Time {
+	epoch := a.epochIn()
+
+	if interval < day && day%interval == 0 {
+		return a.nextWall(t.In(a.loc), interval, timeOfDay(epoch)%interval)
+	}
+
+	if interval%day == 0 {
+		days := int(interval / day)
+		// rough guess, then walk to the exact boundary
+		k := int(t.Sub(epoch)/interval) - 1
+		boundary := epoch.AddDate(0, 0, k*days)
+		for !boundary.After(t) {
+			k++
+			boundary = epoch.AddDate(0, 0, k*days)
+		}
+		for {
+			prev := epoch.AddDate(0, 0, (k-1)*days)
+			if !prev.After(t) {
+				break
+			}
+			k--
+			boundary = prev
+		}
+		return boundary
+	}
+
+	elapsed := t.Sub(epoch)
+	k := elapsed / interval
+	if elapsed < 0 && elapsed%interval != 0 {
+		k--
+	}
+
+	return epoch.Add((k + 1) * interval)
+}
+
+// nextWall returns the first time strictly after t whose local time of day is
+// phase plus a multiple of interval. Within a zone the wall clock moves with
+// absolute time, so the boundary is searched zone by zone.
+func (a *alignment) nextWall(t time.Time, interval, phase time.Duration) time.Time {
+	from, strict := t, true
+	for {
+		offset := (timeOfDay(from) - phase) % interval
+		if offset < 0 {
+			offset += interval
+		}
+		wait := interval - offset
+		if !strict && offset == 0 {
+			wait = 0
+		}
+
+		boundary := from.Add(wait)
+		_, end := from.ZoneBounds()
+		if end.IsZero() || boundary.Before(end) {
+			return boundary
+		}
+		// the offset changes first, continue on the wall clock of the next zone
+		from, strict = end, false
+	}
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	hour, minute, second := t.Clock()
+
+	return time.Duration(hour)*time.Hour +
+		time.Duration(minute)*time.Minute +
+		time.Duration(second)*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+func (a *alignment) epochIn() time.Time {
+	if a.epoch.IsZero() {
+		return time.Date(2000, time.January, 1, 0, 0, 0, 0, a.loc)
+	}
+
+	e := a.epoch
+	return time.Date(e.Year(), e.Month(), e.Day(), e.Hour(), e.Minute(), e.Second(), e.Nanosecond(), a.loc)
+}
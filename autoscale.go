@@ -0,0 +1,242 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Autoscaler struct {
+	min, max      int
+	interval      time.Duration
+	cooldown      time.Duration
+	upBacklog     float64
+	downBacklog   float64
+	targetLatency time.Duration
+
+	mu         sync.Mutex
+	target     int
+	active     int
+	latency    time.Duration
+	lastScaled time.Time
+	current    atomic.Int64
+}
+
+type AutoscaleOpt func(*Autoscaler)
+
+func WithScaleInterval(interval time.Duration) AutoscaleOpt {
+	return func(a *Autoscaler) {
+		if interval > 0 {
+			a.interval = interval
+		}
+	}
+}
+
+func WithScaleCooldown(cooldown time.Duration) AutoscaleOpt {
+	return func(a *Autoscaler) {
+		if cooldown >= 0 {
+			a.cooldown = cooldown
+		}
+	}
+}
+
+// WithScaleBacklog sets the backlog ratios, len(ch)/cap(ch), above which the
+// worker scales up and below which it scales down.
+func WithScaleBacklog(up, down float64) AutoscaleOpt {
+	return func(a *Autoscaler) {
+		if up > down && down >= 0 {
+			a.upBacklog = up
+			a.downBacklog = down
+		}
+	}
+}
+
+// WithScaleTargetLatency stops scaling up, and scales down, while the average
+// handler latency is above target, so a struggling downstream is not given
+// even more load.
+func WithScaleTargetLatency(target time.Duration) AutoscaleOpt {
+	return func(a *Autoscaler) {
+		if target > 0 {
+			a.targetLatency = target
+		}
+	}
+}
+
+// NewAutoscaler returns an autoscaler for a single worker, see
+// WithWorkerAutoscaler. The worker starts with min goroutines and changes by
+// one goroutine at a time. Scaling down only retires a goroutine between two
+// items, never one that is handling an item.
+func NewAutoscaler(min, max int, opts ...AutoscaleOpt) *Autoscaler {
+	if min <= 0 || max < min {
+		panic("autoscaler bounds must satisfy 0 < min <= max")
+	}
+
+	a := &Autoscaler{
+		min:         min,
+		max:         max,
+		interval:    time.Second,
+		cooldown:    10 * time.Second,
+		upBacklog:   0.5,
+		downBacklog: 0.1,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Concurrency reports the number of goroutines currently running the worker.
+func (a *Autoscaler) Concurrency() int {
+	return int(a.current.Load())
+}
+
+func (a *Autoscaler) observe(d time.Duration) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// exponentially weighted moving average
+	if a.latency == 0 {
+		a.latency = d
+	} else {
+		a.latency += (d - a.latency) / 8
+	}
+}
+
+func (a *Autoscaler) start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.target = a.min
+	a.active = a.min
+	a.latency = 0
+	a.lastScaled = time.Time{}
+	a.current.Store(int64(a.active))
+}
+
+// retire is called by a goroutine between two items.
+func (a *Autoscaler) retire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.active <= a.target {
+		return false
+	}
+	a.active--
+	a.current.Store(int64(a.active))
+
+	return true
+}
+
+// exited is called when a goroutine stops for any other reason.
+func (a *Autoscaler) exited() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.active--
+	a.current.Store(int64(a.active))
+}
+
+// scale adjusts the target and returns how many goroutines to start.
+func (a *Autoscaler) scale(now time.Time, backlog, capacity int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.lastScaled) < a.cooldown {
+		return 0
+	}
+
+	ratio := 0.0
+	switch {
+	case capacity > 0:
+		ratio = float64(backlog) / float64(capacity)
+	case backlog > 0:
+		ratio = 1
+	}
+	slow := a.targetLatency > 0 && a.latency > a.targetLatency
+
+	switch {
+	case ratio >= a.upBacklog && !slow && a.target < a.max:
+		a.target++
+	case (ratio <= a.downBacklog || slow) && a.target > a.min:
+		a.target--
+	default:
+		return 0
+	}
+	a.lastScaled = now
+
+	spawn := max(a.target-a.active, 0)
+	a.active += spawn
+	a.current.Store(int64(a.active))
+
+	return spawn
+}
+
+func autoscale[T any](ctx context.Context, cancel context.CancelFunc, recvCtx context.Context, cfg *worker, state *workerState, src Source[T], runner WorkerHandler[T]) error {
+	a := cfg.autoscaler
+	a.start()
+
+	var (
+		wg        sync.WaitGroup
+		fatalOnce sync.Once
+		fatal     error
+		doneOnce  sync.Once
+		exhausted = make(chan struct{})
+	)
+
+	spawn := func(n int) {
+		for range n {
+			wg.Go(func() {
+				retired := false
+				err := consume(ctx, recvCtx, cfg, state, src, runner, func() bool {
+					retired = a.retire()
+					return retired
+				})
+				if retired {
+					return
+				}
+				a.exited()
+
+				if err != nil {
+					fatalOnce.Do(func() {
+						fatal = err
+						cancel()
+					})
+					return
+				}
+				doneOnce.Do(func() { close(exhausted) })
+			})
+		}
+	}
+
+	spawn(a.min)
+
+	backlog, _ := src.(backlogSource)
+	timer := cfg.clock.NewTimer(a.interval)
+	defer timer.Stop()
+
+	for running := true; running; {
+		select {
+		case <-timer.C():
+			var n, capacity int
+			if backlog != nil {
+				n, capacity = backlog.backlog()
+			}
+			spawn(a.scale(cfg.clock.Now(), n, capacity))
+			timer.Reset(a.interval)
+		case <-exhausted:
+			running = false
+		case <-recvCtx.Done():
+			running = false
+		}
+	}
+
+	wg.Wait()
+
+	return fatal
+}
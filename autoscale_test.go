@@ -0,0 +1,144 @@
+package graceful_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoscalerScalesUpOnBacklog(t *testing.T) {
+	ch := make(chan int, 10)
+	for i := range 10 {
+		ch <- i
+	}
+
+	release := make(chan struct{})
+	var processed int32
+	handler := func(ctx context.Context, v int) error {
+		<-release
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}
+
+	autoscaler := graceful.NewAutoscaler(1, 4,
+		graceful.WithScaleInterval(time.Millisecond),
+		graceful.WithScaleCooldown(0),
+	)
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerAutoscaler(autoscaler))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	assert.Eventually(t, func() bool {
+		return autoscaler.Concurrency() == 4
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	close(ch)
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, int32(10), atomic.LoadInt32(&processed))
+	assert.Zero(t, autoscaler.Concurrency())
+}
+
+func TestAutoscalerScalesDownBetweenItems(t *testing.T) {
+	ch := make(chan int, 10)
+	for i := range 10 {
+		ch <- i
+	}
+
+	var processed int32
+	handler := func(ctx context.Context, v int) error {
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}
+
+	autoscaler := graceful.NewAutoscaler(1, 4,
+		graceful.WithScaleInterval(time.Millisecond),
+		graceful.WithScaleCooldown(0),
+	)
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerAutoscaler(autoscaler))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&processed) == 10 && autoscaler.Concurrency() == 1
+	}, time.Second, time.Millisecond)
+
+	close(ch)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, int32(10), atomic.LoadInt32(&processed))
+}
+
+func TestAutoscalerScalesDownWhileIdle(t *testing.T) {
+	ch := make(chan int, 10)
+	for i := range 10 {
+		ch <- i
+	}
+
+	release := make(chan struct{})
+	var processed int32
+	handler := func(ctx context.Context, v int) error {
+		<-release
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}
+
+	autoscaler := graceful.NewAutoscaler(1, 4,
+		graceful.WithScaleInterval(time.Millisecond),
+		graceful.WithScaleCooldown(0),
+	)
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerAutoscaler(autoscaler))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	assert.Eventually(t, func() bool {
+		return autoscaler.Concurrency() == 4
+	}, time.Second, time.Millisecond)
+
+	// the channel stays open, the extra goroutines retire while waiting
+	close(release)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&processed) == 10 && autoscaler.Concurrency() == 1
+	}, time.Second, time.Millisecond)
+
+	close(ch)
+	require.NoError(t, <-errCh)
+}
+
+func TestAutoscaledWorkerStopsOnErrWorkerFailure(t *testing.T) {
+	ch := make(chan int)
+	defer close(ch)
+
+	handler := func(ctx context.Context, v int) error {
+		return graceful.ErrWorkerFailure
+	}
+
+	autoscaler := graceful.NewAutoscaler(2, 4)
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerAutoscaler(autoscaler))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	ch <- 1
+
+	select {
+	case err := <-errCh:
+		assert.Equal(t, graceful.ErrWorkerFailure, err)
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop")
+	}
+}
+
+func TestNewAutoscalerInvalidBounds(t *testing.T) {
+	assert.Panics(t, func() { graceful.NewAutoscaler(0, 1) })
+	assert.Panics(t, func() { graceful.NewAutoscaler(3, 2) })
+}
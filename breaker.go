@@ -0,0 +1,113 @@
+package graceful
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+var ErrCircuitOpen = eris.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerConfig struct {
+	threshold int
+	openFor   time.Duration
+	maxOpen   time.Duration
+}
+
+// breaker is a consecutive-failure circuit breaker. After threshold failures
+// in a row it opens for openFor, then lets a single probe through. A failed
+// probe reopens it; once it has been open for longer than maxOpen the failure
+// is escalated to ErrCircuitOpen.
+type breaker struct {
+	mu        sync.Mutex
+	cfg       breakerConfig
+	now       func() time.Time
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	openSince time.Time
+}
+
+func newBreaker(cfg *breakerConfig, now func() time.Time) *breaker {
+	if cfg == nil {
+		return nil
+	}
+
+	return &breaker{cfg: *cfg, now: now}
+}
+
+// acquire returns how long the caller has to wait before it may run. Zero
+// means it may run now.
+func (b *breaker) acquire() time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.openedAt.Add(b.cfg.openFor).Sub(b.now())
+		if remaining > 0 {
+			return remaining
+		}
+		b.state = breakerHalfOpen
+		return 0
+	case breakerHalfOpen:
+		// a probe is already running
+		return b.cfg.openFor
+	default:
+		return 0
+	}
+}
+
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *breaker) failure() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.failures++
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.state = breakerOpen
+		b.openedAt = now
+		if open := now.Sub(b.openSince); b.cfg.maxOpen > 0 && open >= b.cfg.maxOpen {
+			return eris.Wrapf(ErrCircuitOpen, "open for %s after %d failures", open, b.failures)
+		}
+	case breakerClosed:
+		if b.failures >= b.cfg.threshold {
+			b.state = breakerOpen
+			b.openedAt = now
+			b.openSince = now
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package graceful_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/LiquidCats/graceful/v2"
+)
+
+// Test that the fake clock fires timers only once time is advanced past them.
+func TestFakeClockTimer(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := graceful.NewFakeClock(start)
+	timer := clock.NewTimer(time.Minute)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-timer.C())
+	assert.False(t, timer.Stop())
+}
+
+// Test that AfterFunc callbacks run in order of their deadlines.
+func TestFakeClockAfterFunc(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Unix(0, 0))
+
+	fired := make(chan int, 2)
+	clock.AfterFunc(2*time.Second, func() { fired <- 2 })
+	stopped := clock.AfterFunc(time.Second, func() { fired <- 0 })
+	clock.AfterFunc(time.Second, func() { fired <- 1 })
+	assert.True(t, stopped.Stop())
+
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, <-fired)
+	clock.Advance(time.Second)
+	assert.Equal(t, 2, <-fired)
+}
@@ -2,31 +2,655 @@ package graceful
 
 import (
 	"context"
+	"math/rand/v2"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/robfig/cron/v3"
+	"github.com/rotisserie/eris"
+	"github.com/rs/zerolog"
 )
 
+var (
+	ErrScheduleFailure = eris.New("schedule failure")
+	ErrInvalidSpec     = eris.New("invalid cron spec")
+)
+
+// Task is run at every activation of its cron spec. Tasks may implement
+// Name() string to be told apart in logs and errors, otherwise they are named
+// after their spec, Location() *time.Location to evaluate their spec in a
+// time zone other than the one of the schedule, and Overlap() ScheduleOverlap,
+// CatchUp() ScheduleCatchUp or Jitter() time.Duration to override the
+// policies of the schedule.
 type Task interface {
 	Spec() string
 	Run()
 }
 
+// ContextTask is a Task that observes shutdown through its context and reports
+// failures. An error wrapping ErrScheduleFailure stops the schedule, other
+// errors are logged.
+type ContextTask interface {
+	Spec() string
+	Run(ctx context.Context) error
+}
+
+type schedule struct {
+	jobs            []*job
+	clock           Clock
+	logger          *zerolog.Logger
+	shutdownTimeout time.Duration
+	parser          cron.ParseOption
+	location        *time.Location
+	overlap         ScheduleOverlap
+	store           JobStore
+	catchUp         ScheduleCatchUp
+	jitter          time.Duration
+	random          func() float64
+}
+
+type ScheduleOverlap int
+
+const (
+	// ScheduleOverlapAllow starts runs even while previous ones are active.
+	ScheduleOverlapAllow ScheduleOverlap = iota
+	// ScheduleOverlapSkip drops activations while a run is active.
+	ScheduleOverlapSkip
+	// ScheduleOverlapDelay starts each run once the previous ones finished.
+	ScheduleOverlapDelay
+)
+
+type ScheduleCatchUp int
+
+const (
+	// ScheduleCatchUpNone drops runs missed while the schedule was not running.
+	ScheduleCatchUpNone ScheduleCatchUp = iota
+	// ScheduleCatchUpOnce runs once for all missed runs, as of the latest one.
+	ScheduleCatchUpOnce
+	// ScheduleCatchUpAll runs once for every missed run, subject to the
+	// overlap policy, so ScheduleOverlapDelay runs them one after another.
+	ScheduleCatchUpAll
+)
+
+type job struct {
+	source   any
+	name     string
+	location *time.Location
+	task     ContextTask
+	schedule cron.Schedule
+	overlap  ScheduleOverlap
+	catchUp  ScheduleCatchUp
+	jitter   time.Duration
+
+	guard   *overlapGuard
+	skipped atomic.Int64
+	running atomic.Int32
+	removed atomic.Bool
+	stop    context.CancelFunc
+
+	mu       sync.Mutex
+	paused   bool
+	prev     time.Time
+	duration time.Duration
+	lastErr  error
+}
+
+// overlapGuard keeps runs of a task from overlapping. It outlives the job, so
+// an updated task does not start while a run of the old one is active.
+type overlapGuard struct {
+	busy   atomic.Bool
+	serial sync.Mutex
+}
+
+func newJob(source any, task ContextTask) *job {
+	j := &job{source: source, name: task.Spec(), task: task, guard: &overlapGuard{}}
+	if named, ok := source.(interface{ Name() string }); ok {
+		j.name = named.Name()
+	}
+	if located, ok := source.(interface{ Location() *time.Location }); ok {
+		j.location = located.Location()
+	}
+
+	return j
+}
+
+func (j *job) isPaused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.paused
+}
+
+func (j *job) finished(started time.Time, duration time.Duration, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.prev = started
+	j.duration = duration
+	j.lastErr = err
+}
+
+type ScheduleOpt func(*schedule)
+
+func WithScheduleTasks(tasks ...Task) ScheduleOpt {
+	return func(s *schedule) {
+		for _, task := range tasks {
+			s.jobs = append(s.jobs, newJob(task, plainTask{task}))
+		}
+	}
+}
+
+func WithScheduleContextTasks(tasks ...ContextTask) ScheduleOpt {
+	return func(s *schedule) {
+		for _, task := range tasks {
+			s.jobs = append(s.jobs, newJob(task, task))
+		}
+	}
+}
+
+// WithScheduleClock sets the clock the task specs are evaluated against.
+func WithScheduleClock(clock Clock) ScheduleOpt {
+	return func(s *schedule) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+func WithScheduleLogger(logger *zerolog.Logger) ScheduleOpt {
+	return func(s *schedule) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithScheduleShutdownTimeout waits up to timeout on shutdown for runs that
+// are still in flight, then cancels their contexts and fails with the names
+// of the tasks that did not finish. Without it, runs are cancelled on
+// shutdown and not awaited.
+func WithScheduleShutdownTimeout(timeout time.Duration) ScheduleOpt {
+	return func(s *schedule) {
+		if timeout > 0 {
+			s.shutdownTimeout = timeout
+		}
+	}
+}
+
+// WithScheduleSeconds accepts specs with a leading seconds field. Specs with
+// the usual five fields still run at second zero.
+func WithScheduleSeconds() ScheduleOpt {
+	return func(s *schedule) {
+		s.parser |= cron.SecondOptional
+	}
+}
+
+// WithScheduleDescriptors toggles descriptors such as @daily or @every 5m,
+// which are accepted by default.
+func WithScheduleDescriptors(enabled bool) ScheduleOpt {
+	return func(s *schedule) {
+		if enabled {
+			s.parser |= cron.Descriptor
+		} else {
+			s.parser &^= cron.Descriptor
+		}
+	}
+}
+
+// WithScheduleLocation sets the time zone specs are evaluated in, time.Local
+// by default. Tasks with a Location method and specs starting with CRON_TZ=
+// override it.
+func WithScheduleLocation(loc *time.Location) ScheduleOpt {
+	return func(s *schedule) {
+		if loc != nil {
+			s.location = loc
+		}
+	}
+}
+
+// WithScheduleOverlap sets what happens when a task is due while its previous
+// run is still active, ScheduleOverlapAllow by default.
+func WithScheduleOverlap(policy ScheduleOverlap) ScheduleOpt {
+	return func(s *schedule) {
+		s.overlap = policy
+	}
+}
+
+// WithScheduleStore records successful runs in store, so that runs missed
+// while the schedule was not running are caught up on start, following the
+// catch-up policy.
+func WithScheduleStore(store JobStore) ScheduleOpt {
+	return func(s *schedule) {
+		s.store = store
+	}
+}
+
+// WithScheduleCatchUp sets what happens to runs missed while the schedule was
+// not running, ScheduleCatchUpNone by default. It needs WithScheduleStore.
+func WithScheduleCatchUp(policy ScheduleCatchUp) ScheduleOpt {
+	return func(s *schedule) {
+		s.catchUp = policy
+	}
+}
+
+// WithScheduleJitter delays every scheduled run by a random duration up to
+// max, so replicas sharing a schedule do not all start at once. It should be
+// shorter than the period of the tasks; manual and catch-up runs are not
+// delayed.
+func WithScheduleJitter(max time.Duration) ScheduleOpt {
+	return func(s *schedule) {
+		if max > 0 {
+			s.jitter = max
+		}
+	}
+}
+
+// WithScheduleRandSource sets the source of the jitter, for deterministic
+// tests.
+func WithScheduleRandSource(src rand.Source) ScheduleOpt {
+	return func(s *schedule) {
+		if src == nil {
+			return
+		}
+		var mu sync.Mutex
+		random := rand.New(src)
+		s.random = func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return random.Float64()
+		}
+	}
+}
+
 func ScheduleRunner(tasks ...Task) Runner {
-	cr := cron.New()
+	return Schedule(WithScheduleTasks(tasks...))
+}
+
+// Schedule is NewSchedule that panics on invalid specs.
+func Schedule(opts ...ScheduleOpt) Runner {
+	runner, err := NewSchedule(opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return runner
+}
 
-	for _, task := range tasks {
-		_, err := cr.AddFunc(task.Spec(), task.Run)
-		if err != nil {
-			panic(err)
+// ValidateSpec reports whether spec is a valid cron spec for a schedule with
+// the given parser options.
+func ValidateSpec(spec string, opts ...ScheduleOpt) error {
+	_, err := newSchedule(opts).parse(spec, nil)
+	return err
+}
+
+// NewSchedule runs the tasks on their cron specs. It fails with every invalid
+// spec, wrapping ErrInvalidSpec, along with the name of its task.
+func NewSchedule(opts ...ScheduleOpt) (Runner, error) {
+	s, err := NewScheduler(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Run, nil
+}
+
+// prepare parses the spec of the job and settles its overlap policy.
+func (s *schedule) prepare(job *job) error {
+	sched, err := s.parse(job.task.Spec(), job.location)
+	if err != nil {
+		return err
+	}
+	job.schedule = sched
+
+	job.overlap = s.overlap
+	if o, ok := job.source.(interface{ Overlap() ScheduleOverlap }); ok {
+		job.overlap = o.Overlap()
+	}
+	job.catchUp = s.catchUp
+	if c, ok := job.source.(interface{ CatchUp() ScheduleCatchUp }); ok {
+		job.catchUp = c.CatchUp()
+	}
+	job.jitter = s.jitter
+	if j, ok := job.source.(interface{ Jitter() time.Duration }); ok {
+		job.jitter = j.Jitter()
+	}
+
+	return nil
+}
+
+func newSchedule(opts []ScheduleOpt) *schedule {
+	noop := zerolog.Nop()
+	cfg := &schedule{
+		clock:    realClock{},
+		logger:   &noop,
+		parser:   cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+		location: time.Local,
+		random:   rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func (s *schedule) jitterOf(job *job) time.Duration {
+	if job.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(s.random() * float64(job.jitter))
+}
+
+// parse parses spec in loc, or in the location of the schedule when loc is
+// nil. A CRON_TZ= prefix of the spec takes precedence over both.
+func (s *schedule) parse(spec string, loc *time.Location) (cron.Schedule, error) {
+	sched, err := cron.NewParser(s.parser).Parse(spec)
+	if err != nil {
+		return nil, eris.Wrapf(ErrInvalidSpec, "%q: %v", spec, err)
+	}
+
+	explicit := strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=")
+	if at, ok := sched.(*cron.SpecSchedule); ok && !explicit {
+		if loc == nil {
+			loc = s.location
+		}
+		at.Location = loc
+	}
+
+	return sched, nil
+}
+
+// drain waits for the runs in flight up to the shutdown timeout and cancels
+// them afterwards.
+func (s *schedule) drain(runs *activeRuns, fail context.CancelCauseFunc) error {
+	if s.shutdownTimeout <= 0 {
+		fail(context.Canceled)
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runs.wg.Wait()
+		close(done)
+	}()
+
+	timer := s.clock.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C():
+	}
+
+	fail(context.DeadlineExceeded)
+	names := runs.names()
+	s.logger.
+		Warn().
+		Strs("tasks", names).
+		Msg("tasks still running after shutdown timeout")
+
+	return eris.Wrapf(context.DeadlineExceeded, "tasks still running after shutdown timeout: %s", strings.Join(names, ", "))
+}
+
+// loop calls start at every activation of the job, delayed by its jitter,
+// until ctx is done. Runs are not awaited, so a slow run does not delay the
+// next one.
+func (s *schedule) loop(ctx context.Context, job *job, start func(at time.Time)) {
+	for {
+		now := s.clock.Now()
+		next := job.schedule.Next(now)
+		if next.IsZero() {
+			// the spec never fires again
+			<-ctx.Done()
+			return
+		}
+		timer := s.clock.NewTimer(next.Sub(now) + s.jitterOf(job))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+			// the timer may win the race against a stop
+			if ctx.Err() != nil {
+				return
+			}
+			start(next)
+		}
+	}
+}
+
+// scheduleRun is the state of a running schedule shared by all its jobs.
+type scheduleRun struct {
+	cfg      *schedule
+	ctx      context.Context
+	stopping context.Context
+	fail     context.CancelCauseFunc
+	loops    sync.WaitGroup
+	runs     activeRuns
+}
+
+// spawn catches up the job and then starts it on its schedule, until the
+// schedule stops or the job is removed.
+func (r *scheduleRun) spawn(job *job) {
+	ctx, stop := context.WithCancel(r.stopping)
+	job.stop = stop
+
+	r.loops.Go(func() {
+		defer stop()
+
+		r.catchUp(ctx, job)
+		r.cfg.loop(ctx, job, func(at time.Time) {
+			r.start(job, at)
+		})
+	})
+}
+
+// catchUp starts the runs of the job missed since its last recorded run.
+func (r *scheduleRun) catchUp(ctx context.Context, job *job) {
+	if r.cfg.store == nil || job.catchUp == ScheduleCatchUpNone {
+		return
+	}
+
+	last, err := r.cfg.store.LastRun(ctx, job.name)
+	if err != nil {
+		r.cfg.logger.
+			Error().
+			Str("task", job.name).
+			Any("error", eris.ToJSON(err, true)).
+			Msg("failed to load last run")
+		return
+	}
+	if last.IsZero() {
+		return
+	}
+
+	now := r.cfg.clock.Now()
+	var missed []time.Time
+	for at := job.schedule.Next(last); !at.IsZero() && !at.After(now); at = job.schedule.Next(at) {
+		missed = append(missed, at)
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	r.cfg.logger.
+		Warn().
+		Str("task", job.name).
+		Int("missed", len(missed)).
+		Msg("task missed runs")
+
+	if job.catchUp == ScheduleCatchUpOnce {
+		missed = missed[len(missed)-1:]
+	}
+	for _, at := range missed {
+		r.start(job, at)
+	}
+}
+
+// start runs the job once for the activation at, following its overlap
+// policy. A zero at is a manual run, which is neither recorded nor held back
+// by a pause.
+func (r *scheduleRun) start(job *job, at time.Time) {
+	if !at.IsZero() && job.isPaused() {
+		r.cfg.logger.
+			Debug().
+			Str("task", job.name).
+			Msg("task paused, skipping run")
+		return
+	}
+
+	exec := func() {
+		r.exec(job, at)
+	}
+
+	switch job.overlap {
+	case ScheduleOverlapSkip:
+		if !job.guard.busy.CompareAndSwap(false, true) {
+			r.cfg.logger.
+				Warn().
+				Str("task", job.name).
+				Int64("skipped", job.skipped.Add(1)).
+				Msg("task still running, skipping run")
+			return
 		}
+		r.runs.start(job.name, func() {
+			defer job.guard.busy.Store(false)
+			exec()
+		})
+	case ScheduleOverlapDelay:
+		r.runs.start(job.name, func() {
+			job.guard.serial.Lock()
+			defer job.guard.serial.Unlock()
+			// runs still waiting at shutdown or removal are dropped
+			if r.stopping.Err() == nil && !job.removed.Load() {
+				exec()
+			}
+		})
+	default:
+		r.runs.start(job.name, exec)
 	}
+}
+
+// exec calls the task once and records its run when it succeeded. A fatal
+// error stops the schedule.
+func (r *scheduleRun) exec(job *job, at time.Time) {
+	job.running.Add(1)
+	defer job.running.Add(-1)
 
-	return func(ctx context.Context) error {
-		cr.Start()
-		defer cr.Stop()
+	r.cfg.logger.Info().Str("task", job.name).Msg("task started")
 
-		<-ctx.Done()
+	started := r.cfg.clock.Now()
+	err := r.call(job)
+	duration := r.cfg.clock.Now().Sub(started)
+	job.finished(started, duration, err)
 
-		return ctx.Err()
+	switch {
+	case err == nil:
+		r.cfg.logger.
+			Info().
+			Str("task", job.name).
+			Dur("duration", duration).
+			Msg("task finished")
+		r.record(job, at)
+	case eris.Is(err, ErrScheduleFailure):
+		r.fail(err)
+	default:
+		r.cfg.logger.
+			Error().
+			Str("task", job.name).
+			Dur("duration", duration).
+			Any("error", eris.ToJSON(err, true)).
+			Msg("task failed")
 	}
 }
+
+// call runs the task, turning a panic into an error.
+func (r *scheduleRun) call(job *job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.cfg.logger.
+				Error().
+				Str("task", job.name).
+				Any("panic", v).
+				Str("stack", string(debug.Stack())).
+				Msg("task panicked")
+			err = eris.Errorf("task panicked: %v", v)
+		}
+	}()
+
+	return job.task.Run(r.ctx)
+}
+
+func (r *scheduleRun) record(job *job, at time.Time) {
+	if r.cfg.store == nil || at.IsZero() {
+		return
+	}
+
+	if err := r.cfg.store.SaveRun(context.WithoutCancel(r.ctx), job.name, at); err != nil {
+		r.cfg.logger.
+			Error().
+			Str("task", job.name).
+			Any("error", eris.ToJSON(err, true)).
+			Msg("failed to record run")
+	}
+}
+
+// plainTask adapts a Task, which can neither fail nor be cancelled.
+type plainTask struct {
+	Task
+}
+
+func (t plainTask) Run(context.Context) error {
+	t.Task.Run()
+	return nil
+}
+
+// activeRuns tracks the runs in flight by task name.
+type activeRuns struct {
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func (a *activeRuns) start(name string, run func()) {
+	a.mu.Lock()
+	if a.running == nil {
+		a.running = make(map[string]int)
+	}
+	a.running[name]++
+	a.mu.Unlock()
+
+	a.wg.Go(func() {
+		defer func() {
+			a.mu.Lock()
+			a.running[name]--
+			if a.running[name] == 0 {
+				delete(a.running, name)
+			}
+			a.mu.Unlock()
+		}()
+
+		run()
+	})
+}
+
+func (a *activeRuns) names() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	names := make([]string, 0, len(a.running))
+	for name := range a.running {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
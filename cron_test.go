@@ -2,11 +2,15 @@ package graceful_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/rotisserie/eris"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -27,16 +31,23 @@ func (m *mockTask) Run() {
 }
 
 func TestScheduleRunnerRunsTask(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
 	task := &mockTask{}
-	runner := graceful.ScheduleRunner(task)
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	errCh := make(chan error)
 
 	go func() { errCh <- runner(ctx) }()
 
-	// Allow some time for the task to run a few times.
-	time.Sleep(2 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&task.runCount) > 0
+	}, time.Second, time.Millisecond)
 	cancel()
 
 	// Wait for the runner to finish and check its return value.
@@ -48,9 +59,13 @@ func TestScheduleRunnerRunsTask(t *testing.T) {
 }
 
 func TestScheduleRunnerMultipleTasks(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
 	task1 := &mockTask{}
 	task2 := &mockTask{}
-	runner := graceful.ScheduleRunner(task1, task2)
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task1, task2),
+		graceful.WithScheduleClock(clock),
+	)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	errCh := make(chan error)
@@ -60,7 +75,11 @@ func TestScheduleRunnerMultipleTasks(t *testing.T) {
 		errCh <- runner(ctx)
 	})
 
-	time.Sleep(2 * time.Second)
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&task1.runCount) > 0 && atomic.LoadInt32(&task2.runCount) > 0
+	}, time.Second, time.Millisecond)
 	cancel()
 
 	err := <-errCh
@@ -86,3 +105,576 @@ func TestScheduleRunnerContextCancel(t *testing.T) {
 	err := <-errCh
 	assert.Equal(t, context.Canceled, err)
 }
+
+// Test that a schedule on a fake clock runs the task once per activation.
+func TestScheduleFakeClock(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 10)
+	task := &funcTask{spec: "@every 1m", run: func() { ran <- struct{}{} }}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner(ctx) }()
+
+	for range 3 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		<-ran
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, ran)
+}
+
+type funcTask struct {
+	spec string
+	run  func()
+}
+
+func (f *funcTask) Spec() string {
+	return f.spec
+}
+
+func (f *funcTask) Run() {
+	f.run()
+}
+
+type funcContextTask struct {
+	spec string
+	run  func(ctx context.Context) error
+}
+
+func (f *funcContextTask) Spec() string {
+	return f.spec
+}
+
+func (f *funcContextTask) Run(ctx context.Context) error {
+	return f.run(ctx)
+}
+
+// Test that errors of a context task are logged and the schedule keeps going.
+func TestScheduleContextTaskErrorLogged(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 2)
+	task := &funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		defer func() { ran <- struct{}{} }()
+		return fmt.Errorf("test error")
+	}}
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	runner := graceful.Schedule(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLogger(&logger),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner(ctx) }()
+
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		<-ran
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Contains(t, buf.String(), "task failed")
+	assert.Contains(t, buf.String(), "test error")
+}
+
+// Test that ErrScheduleFailure stops the schedule with that error.
+func TestScheduleFailure(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	task := &funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		return eris.Wrap(graceful.ErrScheduleFailure, "billing broken")
+	}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
+
+	done := make(chan error)
+	go func() { done <- runner(context.Background()) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+
+	err := <-done
+	assert.ErrorIs(t, err, graceful.ErrScheduleFailure)
+	assert.ErrorContains(t, err, "billing broken")
+}
+
+// Test that the context of a running task is cancelled on shutdown.
+func TestScheduleContextTaskCancelled(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	started := make(chan struct{})
+	stopped := make(chan error)
+	task := &funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil
+	}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = runner(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+
+	cancel()
+	assert.ErrorIs(t, <-stopped, context.Canceled)
+}
+
+// Test that shutdown waits for runs in flight.
+func TestScheduleShutdownWaitsForRuns(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+	task := &funcTask{spec: "@every 1m", run: func() {
+		close(started)
+		<-release
+		finished.Store(true)
+	}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleShutdownTimeout(time.Minute),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("schedule returned before the run finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.True(t, finished.Load())
+}
+
+type namedTask struct {
+	funcContextTask
+	name string
+}
+
+func (n *namedTask) Name() string {
+	return n.name
+}
+
+// Test that runs still in flight after the shutdown timeout are cancelled and
+// reported by name.
+func TestScheduleShutdownTimeout(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	task := &namedTask{name: "billing", funcContextTask: funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}}}
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	runner := graceful.Schedule(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLogger(&logger),
+		graceful.WithScheduleShutdownTimeout(5*time.Second),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+
+	cancel()
+	var err error
+	// the shutdown timer is armed shortly after the cancellation
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Second)
+		select {
+		case err = <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "billing")
+	assert.Contains(t, buf.String(), "tasks still running after shutdown timeout")
+	<-cancelled
+}
+
+// Test that NewSchedule reports every invalid spec with its task name.
+func TestNewScheduleInvalidSpecs(t *testing.T) {
+	runner, err := graceful.NewSchedule(
+		graceful.WithScheduleTasks(&funcTask{spec: "@every 1m"}),
+		graceful.WithScheduleContextTasks(
+			&namedTask{name: "billing", funcContextTask: funcContextTask{spec: "61 * * * *"}},
+			&namedTask{name: "reports", funcContextTask: funcContextTask{spec: "@sometimes"}},
+		),
+	)
+
+	assert.Nil(t, runner)
+	assert.ErrorIs(t, err, graceful.ErrInvalidSpec)
+	assert.ErrorContains(t, err, "billing")
+	assert.ErrorContains(t, err, "61 * * * *")
+	assert.ErrorContains(t, err, "reports")
+	assert.ErrorContains(t, err, "@sometimes")
+}
+
+func TestScheduleRunnerPanicsOnInvalidSpec(t *testing.T) {
+	assert.Panics(t, func() {
+		graceful.ScheduleRunner(&funcTask{spec: "not a spec"})
+	})
+}
+
+func TestValidateSpec(t *testing.T) {
+	assert.NoError(t, graceful.ValidateSpec("*/5 * * * *"))
+	assert.NoError(t, graceful.ValidateSpec("@daily"))
+	assert.ErrorIs(t, graceful.ValidateSpec("* * *"), graceful.ErrInvalidSpec)
+}
+
+// Test that specs with a seconds field run at second granularity.
+func TestScheduleSeconds(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan time.Time, 10)
+	task := &funcTask{spec: "*/10 * * * * *", run: func() { ran <- clock.Now() }}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleSeconds(),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = runner(ctx) }()
+
+	for i := range 3 {
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Second)
+		assert.Equal(t, time.Duration(i+1)*10*time.Second, (<-ran).Sub(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	}
+}
+
+type locatedTask struct {
+	funcTask
+	loc *time.Location
+}
+
+func (l *locatedTask) Location() *time.Location {
+	return l.loc
+}
+
+// Test that tasks in different time zones run side by side.
+func TestScheduleLocations(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := graceful.NewFakeClock(start)
+
+	ran := make(chan string, 2)
+	eu := &funcTask{spec: "0 9 * * *", run: func() { ran <- "eu" }}
+	us := &locatedTask{loc: newYork, funcTask: funcTask{spec: "0 9 * * *", run: func() { ran <- "us" }}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(eu, us),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLocation(time.UTC),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = runner(ctx) }()
+
+	// 9:00 in UTC, then 9:00 in New York, 14:00 UTC
+	clock.BlockUntil(2)
+	clock.Advance(9 * time.Hour)
+	assert.Equal(t, "eu", <-ran)
+
+	clock.BlockUntil(2)
+	clock.Advance(5 * time.Hour)
+	assert.Equal(t, "us", <-ran)
+}
+
+func TestValidateSpecOptions(t *testing.T) {
+	assert.ErrorIs(t, graceful.ValidateSpec("*/10 * * * * *"), graceful.ErrInvalidSpec)
+	assert.NoError(t, graceful.ValidateSpec("*/10 * * * * *", graceful.WithScheduleSeconds()))
+	assert.ErrorIs(t, graceful.ValidateSpec("@daily", graceful.WithScheduleDescriptors(false)), graceful.ErrInvalidSpec)
+	assert.NoError(t, graceful.ValidateSpec("CRON_TZ=Europe/Berlin 0 9 * * *"))
+}
+
+// Test that activations are skipped and logged while a run is active.
+func TestScheduleOverlapSkip(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	var runs atomic.Int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	task := &funcTask{spec: "@every 1m", run: func() {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+	}}
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLogger(&logger),
+		graceful.WithScheduleOverlap(graceful.ScheduleOverlapSkip),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = runner(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+	}
+	clock.BlockUntil(1)
+	close(release)
+
+	assert.Equal(t, int32(1), runs.Load())
+	assert.Contains(t, buf.String(), "task still running, skipping run")
+	assert.Contains(t, buf.String(), `"skipped":2`)
+}
+
+type overlapTask struct {
+	funcTask
+	overlap graceful.ScheduleOverlap
+}
+
+func (o *overlapTask) Overlap() graceful.ScheduleOverlap {
+	return o.overlap
+}
+
+// Test that a delayed run starts once the previous one finished, following the
+// policy of the task over the one of the schedule.
+func TestScheduleOverlapDelay(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	var active, overlapped atomic.Int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{}, 2)
+	task := &overlapTask{overlap: graceful.ScheduleOverlapDelay, funcTask: funcTask{spec: "@every 1m", run: func() {
+		if active.Add(1) > 1 {
+			overlapped.Add(1)
+		}
+		defer active.Add(-1)
+		started <- struct{}{}
+		<-release
+	}}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleOverlap(graceful.ScheduleOverlapSkip),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = runner(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+
+	select {
+	case <-started:
+		t.Fatal("delayed run started while the previous one was active")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	assert.Zero(t, overlapped.Load())
+}
+
+// Test that runs missed since the last recorded run are caught up on start.
+func TestScheduleCatchUp(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 3, 30, 0, 0, time.UTC)
+	last := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		policy graceful.ScheduleCatchUp
+		runs   []time.Time
+	}{
+		{graceful.ScheduleCatchUpNone, nil},
+		{graceful.ScheduleCatchUpOnce, []time.Time{last.Add(3 * time.Hour)}},
+		{graceful.ScheduleCatchUpAll, []time.Time{last.Add(time.Hour), last.Add(2 * time.Hour), last.Add(3 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		clock := graceful.NewFakeClock(start)
+		store := graceful.NewMemoryJobStore()
+		require.NoError(t, store.SaveRun(context.Background(), "hourly", last))
+
+		var mu sync.Mutex
+		var runs []time.Time
+		task := &namedTask{name: "hourly", funcContextTask: funcContextTask{spec: "0 * * * *", run: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, clock.Now())
+			return nil
+		}}}
+		runner := graceful.Schedule(
+			graceful.WithScheduleContextTasks(task),
+			graceful.WithScheduleClock(clock),
+			graceful.WithScheduleStore(store),
+			graceful.WithScheduleCatchUp(tt.policy),
+			graceful.WithScheduleOverlap(graceful.ScheduleOverlapDelay),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- runner(ctx) }()
+
+		want := last
+		if len(tt.runs) > 0 {
+			want = tt.runs[len(tt.runs)-1]
+		}
+		assert.Eventually(t, func() bool {
+			got, err := store.LastRun(context.Background(), "hourly")
+			return err == nil && got.Equal(want)
+		}, time.Second, time.Millisecond, "policy %d", tt.policy)
+
+		// the regular schedule goes on after catching up
+		clock.BlockUntil(1)
+		clock.Advance(30 * time.Minute)
+		assert.Eventually(t, func() bool {
+			got, err := store.LastRun(context.Background(), "hourly")
+			return err == nil && got.Equal(start.Add(30*time.Minute))
+		}, time.Second, time.Millisecond, "policy %d", tt.policy)
+
+		cancel()
+		<-done
+
+		mu.Lock()
+		assert.Len(t, runs, len(tt.runs)+1, "policy %d", tt.policy)
+		mu.Unlock()
+	}
+}
+
+// Test that runs are logged with the task name and their duration, and that
+// panics are recovered.
+func TestScheduleLogging(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 2)
+	var panicked atomic.Bool
+	task := &namedTask{name: "billing", funcContextTask: funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		defer func() { ran <- struct{}{} }()
+		if panicked.CompareAndSwap(false, true) {
+			panic("boom")
+		}
+		return nil
+	}}}
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	scheduler, err := graceful.NewScheduler(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLogger(&logger),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		<-ran
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), "task finished")
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"task":"billing"`)
+	assert.Contains(t, logs, "task started")
+	assert.Contains(t, logs, "task panicked")
+	assert.Contains(t, logs, "boom")
+	assert.Contains(t, logs, `"duration":`)
+	assert.Contains(t, logs, "task failed")
+	assert.NoError(t, scheduler.Tasks()[0].LastError)
+}
+
+type jitterTask struct {
+	funcTask
+	jitter time.Duration
+}
+
+func (j *jitterTask) Jitter() time.Duration {
+	return j.jitter
+}
+
+// Test that scheduled runs are delayed by the jitter of their task.
+func TestScheduleJitter(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 1)
+	task := &jitterTask{jitter: 20 * time.Second, funcTask: funcTask{spec: "@every 1m", run: func() { ran <- struct{}{} }}}
+	runner := graceful.Schedule(
+		graceful.WithScheduleTasks(task),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleJitter(time.Hour),
+		graceful.WithScheduleRandSource(halfSource{}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = runner(ctx) }()
+
+	// 1m period plus half of the 20s jitter of the task
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	assert.Empty(t, ran)
+	clock.Advance(10 * time.Second)
+	<-ran
+}
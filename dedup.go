@@ -0,0 +1,164 @@
+package graceful
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type DedupStore interface {
+	// Reserve records id and reports whether it had not been seen yet.
+	Reserve(ctx context.Context, id string) (bool, error)
+	// Release forgets id, so an item that failed can be processed again.
+	Release(ctx context.Context, id string) error
+}
+
+type dedup struct {
+	id     func(any) (string, bool)
+	window time.Duration
+	size   int
+	store  DedupStore
+	clock  Clock
+}
+
+type DedupOpt func(*dedup)
+
+func WithDedupWindow(window time.Duration) DedupOpt {
+	return func(d *dedup) {
+		if window > 0 {
+			d.window = window
+		}
+	}
+}
+
+func WithDedupSize(size int) DedupOpt {
+	return func(d *dedup) {
+		if size > 0 {
+			d.size = size
+		}
+	}
+}
+
+func WithDedupStore(store DedupStore) DedupOpt {
+	return func(d *dedup) {
+		d.store = store
+	}
+}
+
+// WithDedupClock sets the clock the memory store measures the window with.
+func WithDedupClock(clock Clock) DedupOpt {
+	return func(d *dedup) {
+		if clock != nil {
+			d.clock = clock
+		}
+	}
+}
+
+// WithWorkerDedup skips items whose id was already handled successfully, or
+// is being handled, within the dedup window. Ids are kept in memory for 10
+// minutes, up to 10000 of them, unless configured otherwise.
+func WithWorkerDedup[T any](id func(T) string, opts ...DedupOpt) WorkerOpt {
+	cfg := &dedup{
+		id: func(value any) (string, bool) {
+			v, ok := value.(T)
+			if !ok {
+				return "", false
+			}
+			return id(v), true
+		},
+		window: 10 * time.Minute,
+		size:   10000,
+		clock:  realClock{},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.store == nil {
+		cfg.store = NewMemoryDedupStore(cfg.window, cfg.size, WithDedupClock(cfg.clock))
+	}
+
+	return func(w *worker) {
+		w.dedup = cfg
+	}
+}
+
+type memoryDedupStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	size    int
+	clock   Clock
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// NewMemoryDedupStore keeps ids for window, evicting the oldest ones once it
+// holds size of them. Zero disables either bound. Of the options only
+// WithDedupClock applies.
+func NewMemoryDedupStore(window time.Duration, size int, opts ...DedupOpt) DedupStore {
+	cfg := &dedup{clock: realClock{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &memoryDedupStore{
+		window:  window,
+		size:    size,
+		clock:   cfg.clock,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (s *memoryDedupStore) Reserve(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	s.evict(now)
+
+	if _, ok := s.entries[id]; ok {
+		return false, nil
+	}
+
+	s.entries[id] = s.order.PushBack(dedupEntry{id: id, seen: now})
+	if s.size > 0 && s.order.Len() > s.size {
+		s.remove(s.order.Front())
+	}
+
+	return true, nil
+}
+
+func (s *memoryDedupStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+
+	return nil
+}
+
+func (s *memoryDedupStore) evict(now time.Time) {
+	if s.window <= 0 {
+		return
+	}
+
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		if now.Sub(el.Value.(dedupEntry).seen) < s.window {
+			return
+		}
+		s.remove(el)
+	}
+}
+
+func (s *memoryDedupStore) remove(el *list.Element) {
+	delete(s.entries, el.Value.(dedupEntry).id)
+	s.order.Remove(el)
+}
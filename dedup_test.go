@@ -0,0 +1,125 @@
+package graceful_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type delivery struct {
+	id      string
+	payload int
+}
+
+func deliveryID(d delivery) string { return d.id }
+
+func TestWorkerDedupSkipsDuplicates(t *testing.T) {
+	src := graceful.NewMemorySource(
+		delivery{id: "a", payload: 1},
+		delivery{id: "b", payload: 2},
+		delivery{id: "a", payload: 3},
+	)
+	src.Close()
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	var processed []int
+	runner := graceful.SourceWorker[delivery](src, func(ctx context.Context, d delivery) error {
+		processed = append(processed, d.payload)
+		return nil
+	}, graceful.WithWorkerDedup(deliveryID), graceful.WithWorkerLogger(&logger))
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []int{1, 2}, processed)
+	assert.Len(t, src.Acked(), 3)
+	assert.Contains(t, buf.String(), "skipping duplicate item")
+}
+
+func TestWorkerDedupRetriesFailedItems(t *testing.T) {
+	src := graceful.NewMemorySource(delivery{id: "a", payload: 1})
+	src.Close()
+
+	var attempts int
+	runner := graceful.SourceWorker[delivery](src, func(ctx context.Context, d delivery) error {
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("temporary")
+		}
+		return nil
+	}, graceful.WithWorkerDedup(deliveryID))
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestMemoryDedupStoreWindow(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
+	store := graceful.NewMemoryDedupStore(time.Minute, 0, graceful.WithDedupClock(clock))
+	ctx := context.Background()
+
+	fresh, err := store.Reserve(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	clock.Advance(59 * time.Second)
+	fresh, _ = store.Reserve(ctx, "a")
+	assert.False(t, fresh)
+
+	clock.Advance(time.Second)
+	fresh, _ = store.Reserve(ctx, "a")
+	assert.True(t, fresh)
+}
+
+func TestMemoryDedupStoreSize(t *testing.T) {
+	store := graceful.NewMemoryDedupStore(0, 2)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		fresh, err := store.Reserve(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, fresh)
+	}
+
+	// "a" was evicted to make room for "c"
+	fresh, _ := store.Reserve(ctx, "a")
+	assert.True(t, fresh)
+	fresh, _ = store.Reserve(ctx, "c")
+	assert.False(t, fresh)
+}
+
+type countingStore struct {
+	graceful.DedupStore
+	reserved int
+}
+
+func (s *countingStore) Reserve(ctx context.Context, id string) (bool, error) {
+	s.reserved++
+	return s.DedupStore.Reserve(ctx, id)
+}
+
+func TestWorkerDedupCustomStore(t *testing.T) {
+	store := &countingStore{DedupStore: graceful.NewMemoryDedupStore(time.Minute, 10)}
+
+	ch := make(chan delivery, 2)
+	ch <- delivery{id: "a"}
+	ch <- delivery{id: "a"}
+	close(ch)
+
+	var processed int
+	runner := graceful.Worker[delivery](ch, func(ctx context.Context, d delivery) error {
+		processed++
+		return nil
+	}, graceful.WithWorkerDedup(deliveryID, graceful.WithDedupStore(store)))
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, 1, processed)
+	assert.Equal(t, 2, store.reserved)
+}
@@ -11,9 +11,11 @@ import (
 )
 
 type server struct {
-	Port         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	Port            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	ShutdownTimeout time.Duration
+	Clock           Clock
 }
 
 type ServerOpt func(*server)
@@ -36,11 +38,25 @@ func WithWriteTimeout(timeout time.Duration) ServerOpt {
 	}
 }
 
+func WithShutdownTimeout(timeout time.Duration) ServerOpt {
+	return func(s *server) {
+		s.ShutdownTimeout = timeout
+	}
+}
+
+func WithServerClock(clock Clock) ServerOpt {
+	return func(s *server) {
+		s.Clock = clockOrReal(clock)
+	}
+}
+
 func Server(router http.Handler, opts ...ServerOpt) Runner {
 	cfg := &server{
-		Port:         "8080",
-		ReadTimeout:  60 * time.Second,
-		WriteTimeout: 60 * time.Second,
+		Port:            "8080",
+		ReadTimeout:     60 * time.Second,
+		WriteTimeout:    60 * time.Second,
+		ShutdownTimeout: 5 * time.Second,
+		Clock:           realClock{},
 	}
 
 	for _, opt := range opts {
@@ -69,7 +85,7 @@ func Server(router http.Handler, opts ...ServerOpt) Runner {
 		group.Go(func() error {
 			<-groupCtx.Done()
 
-			srvCtx, cancel := context.WithTimeout(context.WithoutCancel(groupCtx), 5*time.Second)
+			srvCtx, cancel := withTimeout(context.WithoutCancel(groupCtx), cfg.Clock, cfg.ShutdownTimeout)
 			defer cancel()
 
 			if err := server.Shutdown(srvCtx); err != nil {
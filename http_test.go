@@ -74,3 +74,45 @@ func TestServerInvalidPortReturnsError(t *testing.T) {
 	err := runner(context.Background())
 	assert.Error(t, err)
 }
+
+// Test that shutdown gives up on in-flight requests after the shutdown timeout.
+func TestServerShutdownTimeout(t *testing.T) {
+	port := getFreePort()
+	clock := graceful.NewFakeClock(time.Now())
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	runner := graceful.Server(router,
+		graceful.WithPort(port),
+		graceful.WithShutdownTimeout(time.Minute),
+		graceful.WithServerClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner(ctx) }()
+
+	url := fmt.Sprintf("http://127.0.0.1:%s/", port)
+	go func() {
+		for {
+			resp, err := http.Get(url)
+			if err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	<-entered
+
+	cancel()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
@@ -0,0 +1,128 @@
+package graceful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// JobStore keeps the activation time of the last successful run of every
+// scheduled task, so runs missed while the process was down can be caught up.
+type JobStore interface {
+	// LastRun returns the last recorded run of the task, zero if there is none.
+	LastRun(ctx context.Context, task string) (time.Time, error)
+	// SaveRun records a run of the task, unless a later one is recorded
+	// already.
+	SaveRun(ctx context.Context, task string, at time.Time) error
+	// Runs returns the last recorded run of every task.
+	Runs(ctx context.Context) (map[string]time.Time, error)
+}
+
+type memoryJobStore struct {
+	mu   sync.Mutex
+	runs map[string]time.Time
+}
+
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{runs: map[string]time.Time{}}
+}
+
+func (s *memoryJobStore) LastRun(_ context.Context, task string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.runs[task], nil
+}
+
+func (s *memoryJobStore) SaveRun(_ context.Context, task string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.After(s.runs[task]) {
+		s.runs[task] = at
+	}
+
+	return nil
+}
+
+func (s *memoryJobStore) Runs(_ context.Context) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.runs), nil
+}
+
+type fileJobStore struct {
+	memoryJobStore
+	path string
+}
+
+// OpenFileJobStore keeps the runs in a JSON file at path, which is created on
+// the first saved run. Every save rewrites the file atomically.
+func OpenFileJobStore(path string) (JobStore, error) {
+	s := &fileJobStore{
+		memoryJobStore: memoryJobStore{runs: map[string]time.Time{}},
+		path:           path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read job store")
+	}
+	if err := json.Unmarshal(data, &s.runs); err != nil {
+		return nil, eris.Wrap(err, "failed to decode job store")
+	}
+
+	return s, nil
+}
+
+func (s *fileJobStore) SaveRun(_ context.Context, task string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !at.After(s.runs[task]) {
+		return nil
+	}
+
+	runs := maps.Clone(s.runs)
+	runs[task] = at
+	if err := s.write(runs); err != nil {
+		return err
+	}
+	s.runs = runs
+
+	return nil
+}
+
+func (s *fileJobStore) write(runs map[string]time.Time) error {
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return eris.Wrap(err, "failed to encode job store")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return eris.Wrap(err, "failed to create job store")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err := errors.Join(err, f.Sync(), f.Close()); err != nil {
+		return eris.Wrap(err, "failed to write job store")
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return eris.Wrap(err, "failed to replace job store")
+	}
+
+	return nil
+}
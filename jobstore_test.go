@@ -0,0 +1,62 @@
+package graceful_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiquidCats/graceful/v2"
+)
+
+// Test that the memory store keeps the latest run of every task.
+func TestMemoryJobStore(t *testing.T) {
+	ctx := context.Background()
+	store := graceful.NewMemoryJobStore()
+	at := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	last, err := store.LastRun(ctx, "billing")
+	require.NoError(t, err)
+	assert.True(t, last.IsZero())
+
+	require.NoError(t, store.SaveRun(ctx, "billing", at.Add(time.Hour)))
+	require.NoError(t, store.SaveRun(ctx, "billing", at))
+	require.NoError(t, store.SaveRun(ctx, "reports", at))
+
+	runs, err := store.Runs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"billing": at.Add(time.Hour), "reports": at}, runs)
+}
+
+// Test that the file store keeps its runs across reopening.
+func TestFileJobStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	at := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := graceful.OpenFileJobStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveRun(ctx, "billing", at))
+
+	store, err = graceful.OpenFileJobStore(path)
+	require.NoError(t, err)
+	last, err := store.LastRun(ctx, "billing")
+	require.NoError(t, err)
+	assert.True(t, at.Equal(last))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are cleaned up")
+}
+
+func TestFileJobStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+
+	_, err := graceful.OpenFileJobStore(path)
+	assert.ErrorContains(t, err, "failed to decode job store")
+}
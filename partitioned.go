@@ -0,0 +1,98 @@
+package graceful
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type PartitionKey[T any] func(T) string
+
+// PartitionedWorker handles items with the same key one at a time and in
+// order, each partition in its own lane. The worker options apply to every
+// lane, except WithWorkerAutoscaler which would break the ordering and is
+// rejected.
+func PartitionedWorker[T any](ch <-chan T, partitions int, key PartitionKey[T], runner WorkerHandler[T], opts ...WorkerOpt) Runner {
+	if partitions <= 0 {
+		panic("partitions must be greater than zero")
+	}
+
+	cfg := newWorker(opts)
+	if cfg.autoscaler != nil {
+		panic("partitioned workers cannot be autoscaled")
+	}
+
+	return func(ctx context.Context) error {
+		group, groupCtx := errgroup.WithContext(ctx)
+
+		// failed is closed as soon as any lane stops with a fatal error, so the
+		// dispatcher does not block forever on a lane nobody reads anymore.
+		failed := make(chan struct{})
+		var once sync.Once
+
+		lanes := make([]chan T, partitions)
+		for i := range lanes {
+			lane := make(chan T, cfg.partitionBuffer)
+			lanes[i] = lane
+
+			group.Go(func() error {
+				err := Worker(lane, runner, opts...)(groupCtx)
+				if err != nil {
+					once.Do(func() { close(failed) })
+				}
+				return err
+			})
+		}
+
+		group.Go(func() error {
+			defer func() {
+				for _, lane := range lanes {
+					close(lane)
+				}
+			}()
+
+			for {
+				var value T
+				select {
+				case v, ok := <-ch:
+					if !ok {
+						return nil
+					}
+					value = v
+				case <-failed:
+					return nil
+				}
+
+				select {
+				case lanes[partition(key(value), partitions)] <- value:
+				case <-failed:
+					return nil
+				}
+			}
+		})
+
+		return group.Wait()
+	}
+}
+
+func partition(key string, partitions int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return jumpHash(h.Sum64(), partitions)
+}
+
+// jumpHash is the Lamping-Veach jump consistent hash: changing the number of
+// partitions only remaps the minimal share of keys.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
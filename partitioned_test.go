@@ -0,0 +1,155 @@
+package graceful_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	account string
+	seq     int
+}
+
+func eventKey(e event) string { return e.account }
+
+func TestPartitionedWorkerKeepsOrderPerKey(t *testing.T) {
+	ch := make(chan event)
+
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	handler := func(ctx context.Context, e event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[e.account] = append(seen[e.account], e.seq)
+		return nil
+	}
+
+	runner := graceful.PartitionedWorker(ch, 4, eventKey, handler, graceful.WithWorkerPartitionBuffer(8))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	for seq := range 50 {
+		for acc := range 5 {
+			ch <- event{account: fmt.Sprintf("acc-%d", acc), seq: seq}
+		}
+	}
+	close(ch)
+
+	require.NoError(t, <-errCh)
+	require.Len(t, seen, 5)
+	for acc, seqs := range seen {
+		require.Len(t, seqs, 50, acc)
+		for i, seq := range seqs {
+			assert.Equal(t, i, seq, acc)
+		}
+	}
+}
+
+func TestPartitionedWorkerRunsLanesConcurrently(t *testing.T) {
+	ch := make(chan event)
+
+	started := make(chan struct{}, 16)
+	release := make(chan struct{})
+	handler := func(ctx context.Context, e event) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	// the buffer lets the dispatcher hand every key to its lane without
+	// waiting for the blocked handlers
+	runner := graceful.PartitionedWorker(ch, 8, eventKey, handler, graceful.WithWorkerPartitionBuffer(16))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	for acc := range 16 {
+		ch <- event{account: fmt.Sprintf("acc-%d", acc)}
+	}
+
+	// two handlers blocked at the same time can only be on different lanes
+	for range 2 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("lanes did not run concurrently")
+		}
+	}
+
+	close(release)
+	close(ch)
+
+	require.NoError(t, <-errCh)
+}
+
+func TestPartitionedWorkerStopsOnErrWorkerFailure(t *testing.T) {
+	ch := make(chan event)
+	handler := func(ctx context.Context, e event) error {
+		if e.account == "poison" {
+			return graceful.ErrWorkerFailure
+		}
+		return nil
+	}
+
+	runner := graceful.PartitionedWorker(ch, 2, eventKey, handler)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case ch <- event{account: "poison"}:
+			case <-time.After(100 * time.Millisecond):
+				return
+			}
+		}
+	}()
+
+	assert.ErrorIs(t, <-errCh, graceful.ErrWorkerFailure)
+}
+
+func TestPartitionedWorkerInvalidPartitions(t *testing.T) {
+	assert.Panics(t, func() {
+		graceful.PartitionedWorker(make(chan event), 0, eventKey, func(context.Context, event) error { return nil })
+	})
+}
+
+func TestPartitionedWorkerRejectsAutoscaler(t *testing.T) {
+	assert.Panics(t, func() {
+		graceful.PartitionedWorker(make(chan event), 2, eventKey, func(context.Context, event) error { return nil },
+			graceful.WithWorkerAutoscaler(graceful.NewAutoscaler(1, 4)))
+	})
+}
+
+func TestPartitionedWorkerStopsOnFailureWhileIdle(t *testing.T) {
+	ch := make(chan event)
+	defer close(ch)
+
+	handler := func(ctx context.Context, e event) error {
+		return graceful.ErrWorkerFailure
+	}
+
+	runner := graceful.PartitionedWorker(ch, 2, eventKey, handler)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	ch <- event{account: "poison"}
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, graceful.ErrWorkerFailure)
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop while the channel stayed open")
+	}
+}
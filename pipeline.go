@@ -0,0 +1,221 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rotisserie/eris"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+)
+
+type StageFunc[In, Out any] func(context.Context, In) (Out, error)
+
+type FanOutFunc[In, Out any] func(context.Context, In) ([]Out, error)
+
+type stage struct {
+	name        string
+	logger      *zerolog.Logger
+	concurrency int
+	buffer      int
+}
+
+type StageOpt func(*stage)
+
+func WithStageName(name string) StageOpt {
+	return func(s *stage) {
+		s.name = name
+	}
+}
+
+func WithStageLogger(logger *zerolog.Logger) StageOpt {
+	return func(s *stage) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+func WithStageConcurrency(concurrency int) StageOpt {
+	return func(s *stage) {
+		if concurrency > 0 {
+			s.concurrency = concurrency
+		}
+	}
+}
+
+func WithStageBuffer(size int) StageOpt {
+	return func(s *stage) {
+		if size >= 0 {
+			s.buffer = size
+		}
+	}
+}
+
+func newStage(opts []StageOpt) *stage {
+	noop := zerolog.Nop()
+	cfg := &stage{
+		logger:      &noop,
+		concurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// Pipeline is a typed chain of stages. Every stage runs its own goroutines and
+// closes its output once its input is closed and drained, so closing the
+// source, or cancelling the runner context, drains the stages in order.
+type Pipeline[T any] struct {
+	start func(*pipelineRun) <-chan T
+}
+
+type pipelineRun struct {
+	ctx   context.Context
+	group errgroup.Group
+	once  sync.Once
+	abort chan struct{}
+}
+
+// fail stops every stage without draining, after a fatal error.
+func (r *pipelineRun) fail() {
+	r.once.Do(func() { close(r.abort) })
+}
+
+func NewPipeline[T any](src <-chan T) *Pipeline[T] {
+	return &Pipeline[T]{
+		start: func(r *pipelineRun) <-chan T {
+			out := make(chan T)
+			r.group.Go(func() error {
+				defer close(out)
+
+				for {
+					select {
+					case value, ok := <-src:
+						if !ok {
+							return nil
+						}
+						select {
+						case out <- value:
+						case <-r.abort:
+							return nil
+						}
+					case <-r.ctx.Done():
+						return nil
+					case <-r.abort:
+						return nil
+					}
+				}
+			})
+
+			return out
+		},
+	}
+}
+
+func Then[In, Out any](p *Pipeline[In], fn StageFunc[In, Out], opts ...StageOpt) *Pipeline[Out] {
+	return ThenFanOut(p, func(ctx context.Context, value In) ([]Out, error) {
+		out, err := fn(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		return []Out{out}, nil
+	}, opts...)
+}
+
+func ThenFanOut[In, Out any](p *Pipeline[In], fn FanOutFunc[In, Out], opts ...StageOpt) *Pipeline[Out] {
+	cfg := newStage(opts)
+
+	return &Pipeline[Out]{
+		start: func(r *pipelineRun) <-chan Out {
+			in := p.start(r)
+			out := make(chan Out, cfg.buffer)
+
+			runStage(r, cfg, in, func(ctx context.Context, value In) (bool, error) {
+				values, err := fn(ctx, value)
+				if err != nil {
+					return true, err
+				}
+				for _, v := range values {
+					select {
+					case out <- v:
+					case <-r.abort:
+						return false, nil
+					}
+				}
+				return true, nil
+			}, func() { close(out) })
+
+			return out
+		},
+	}
+}
+
+// Sink consumes the output of the pipeline and returns a Runner for the whole
+// chain. A stage or sink returning ErrWorkerFailure stops every stage and the
+// error is returned by the runner; other errors are logged and the item is
+// dropped.
+func (p *Pipeline[T]) Sink(handler WorkerHandler[T], opts ...StageOpt) Runner {
+	cfg := newStage(opts)
+
+	return func(ctx context.Context) error {
+		r := &pipelineRun{
+			ctx:   ctx,
+			abort: make(chan struct{}),
+		}
+
+		in := p.start(r)
+		runStage(r, cfg, in, func(ctx context.Context, value T) (bool, error) {
+			return true, handler(ctx, value)
+		}, func() {})
+
+		return r.group.Wait()
+	}
+}
+
+func runStage[T any](r *pipelineRun, cfg *stage, in <-chan T, process func(context.Context, T) (bool, error), done func()) {
+	var wg sync.WaitGroup
+	for range cfg.concurrency {
+		wg.Add(1)
+		r.group.Go(func() error {
+			defer wg.Done()
+
+			for {
+				var value T
+				select {
+				case v, ok := <-in:
+					if !ok {
+						return nil
+					}
+					value = v
+				case <-r.abort:
+					return nil
+				}
+
+				more, err := process(r.ctx, value)
+				if err != nil {
+					if eris.Is(err, ErrWorkerFailure) {
+						r.fail()
+						return err
+					}
+					cfg.logger.
+						Error().
+						Str("stage", cfg.name).
+						Any("error", eris.ToJSON(err, true)).
+						Msg("stage failed")
+				}
+				if !more {
+					return nil
+				}
+			}
+		})
+	}
+
+	r.group.Go(func() error {
+		wg.Wait()
+		done()
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+package graceful_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineRunsStagesInOrder(t *testing.T) {
+	src := make(chan int)
+
+	doubled := graceful.Then(graceful.NewPipeline(src), func(ctx context.Context, v int) (int, error) {
+		return v * 2, nil
+	}, graceful.WithStageConcurrency(4), graceful.WithStageBuffer(2))
+	formatted := graceful.ThenFanOut(doubled, func(ctx context.Context, v int) ([]string, error) {
+		return []string{strconv.Itoa(v), strconv.Itoa(v + 1)}, nil
+	})
+
+	var mu sync.Mutex
+	var got []string
+	runner := formatted.Sink(func(ctx context.Context, v string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, v)
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	for i := range 3 {
+		src <- i
+	}
+	close(src)
+
+	require.NoError(t, <-errCh)
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4", "5"}, got)
+}
+
+func TestPipelinePropagatesErrWorkerFailure(t *testing.T) {
+	src := make(chan int)
+	defer close(src)
+
+	stage := graceful.Then(graceful.NewPipeline(src), func(ctx context.Context, v int) (int, error) {
+		return 0, graceful.ErrWorkerFailure
+	})
+	runner := stage.Sink(func(ctx context.Context, v int) error { return nil })
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	src <- 1
+	assert.ErrorIs(t, <-errCh, graceful.ErrWorkerFailure)
+}
+
+func TestPipelineLogsStageErrors(t *testing.T) {
+	src := make(chan int, 2)
+	src <- 1
+	src <- 2
+	close(src)
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	stage := graceful.Then(graceful.NewPipeline(src), func(ctx context.Context, v int) (int, error) {
+		if v == 1 {
+			return 0, fmt.Errorf("test error")
+		}
+		return v, nil
+	}, graceful.WithStageName("parse"), graceful.WithStageLogger(&logger))
+
+	var got []int
+	runner := stage.Sink(func(ctx context.Context, v int) error {
+		got = append(got, v)
+		return nil
+	})
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []int{2}, got)
+	assert.Contains(t, buf.String(), "stage failed")
+	assert.Contains(t, buf.String(), "parse")
+}
+
+func TestPipelineDrainsOnContextCancel(t *testing.T) {
+	src := make(chan int)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stage := graceful.Then(graceful.NewPipeline(src), func(ctx context.Context, v int) (int, error) {
+		return v, nil
+	})
+
+	var got []int
+	runner := stage.Sink(func(_ context.Context, v int) error {
+		got = append(got, v)
+		cancel()
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(ctx) }()
+
+	src <- 1
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []int{1}, got)
+}
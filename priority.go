@@ -0,0 +1,168 @@
+package graceful
+
+import (
+	"context"
+	"reflect"
+	"slices"
+)
+
+// PriorityWorker consumes several channels, listed from the highest priority
+// to the lowest. It always takes the next item from the highest-priority
+// channel that has one, unless WithWorkerStarvationLimit is set. Priorities
+// are strict; weighted sharing between channels is not supported. It finishes
+// once every channel is closed or the context is cancelled.
+func PriorityWorker[T any](chans []<-chan T, runner WorkerHandler[T], opts ...WorkerOpt) Runner {
+	if len(chans) == 0 {
+		panic("at least one channel is required")
+	}
+
+	cfg := newWorker(opts)
+
+	return func(ctx context.Context) error {
+		state := newWorkerState(cfg)
+		selector := &prioritySelector[T]{
+			chans:  slices.Clone(chans),
+			open:   len(chans),
+			limit:  cfg.starvationLimit,
+			cursor: 1,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := state.pause(ctx); err != nil {
+				return err
+			}
+
+			value, ok, err := selector.next(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+
+			if err := handleMessage(ctx, cfg, state, runner, Message[T](chanMessage[T]{value: value})); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type prioritySelector[T any] struct {
+	chans  []<-chan T // closed channels are set to nil
+	open   int
+	limit  int
+	streak int
+	cursor int
+}
+
+func (p *prioritySelector[T]) next(ctx context.Context) (T, bool, error) {
+	for p.open > 0 {
+		if p.limit > 0 && p.streak >= p.limit {
+			p.streak = 0
+			if value, ok := p.tryLower(); ok {
+				return value, true, nil
+			}
+		}
+
+		for i := range p.chans {
+			if value, ok := p.try(i); ok {
+				p.served(i)
+				return value, true, nil
+			}
+		}
+
+		if p.open == 0 {
+			break
+		}
+
+		value, ok, err := p.wait(ctx)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+
+	var zero T
+	return zero, false, nil
+}
+
+// tryLower gives every channel but the first one a turn, round-robin.
+func (p *prioritySelector[T]) tryLower() (T, bool) {
+	n := len(p.chans)
+	for step := range n - 1 {
+		i := 1 + (p.cursor-1+step)%(n-1)
+		if value, ok := p.try(i); ok {
+			p.cursor = 1 + i%(n-1)
+			return value, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+func (p *prioritySelector[T]) try(i int) (T, bool) {
+	var zero T
+	if p.chans[i] == nil {
+		return zero, false
+	}
+
+	select {
+	case value, ok := <-p.chans[i]:
+		if !ok {
+			p.closed(i)
+			return zero, false
+		}
+		return value, true
+	default:
+		return zero, false
+	}
+}
+
+func (p *prioritySelector[T]) wait(ctx context.Context) (T, bool, error) {
+	var zero T
+
+	cases := make([]reflect.SelectCase, 0, len(p.chans)+1)
+	index := make([]int, 0, len(p.chans))
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	for i, ch := range p.chans {
+		if ch != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+			index = append(index, i)
+		}
+	}
+
+	chosen, value, ok := reflect.Select(cases)
+	if chosen == 0 {
+		return zero, false, ctx.Err()
+	}
+
+	i := index[chosen-1]
+	if !ok {
+		p.closed(i)
+		return zero, false, nil
+	}
+	p.served(i)
+
+	// a nil interface value does not assert to T
+	v, _ := value.Interface().(T)
+
+	return v, true, nil
+}
+
+func (p *prioritySelector[T]) served(i int) {
+	for _, ch := range p.chans[i+1:] {
+		if ch != nil {
+			p.streak++
+			return
+		}
+	}
+	p.streak = 0
+}
+
+func (p *prioritySelector[T]) closed(i int) {
+	p.chans[i] = nil
+	p.open--
+}
@@ -0,0 +1,98 @@
+package graceful_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fill(values ...string) chan string {
+	ch := make(chan string, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+func TestPriorityWorkerDrainsHigherPriorityFirst(t *testing.T) {
+	high := fill("h1", "h2", "h3")
+	low := fill("l1", "l2")
+
+	var processed []string
+	runner := graceful.PriorityWorker([]<-chan string{high, low}, func(ctx context.Context, v string) error {
+		processed = append(processed, v)
+		return nil
+	})
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []string{"h1", "h2", "h3", "l1", "l2"}, processed)
+}
+
+func TestPriorityWorkerStarvationLimit(t *testing.T) {
+	high := fill("h1", "h2", "h3", "h4", "h5")
+	mid := fill("m1")
+	low := fill("l1")
+
+	var processed []string
+	runner := graceful.PriorityWorker([]<-chan string{high, mid, low}, func(ctx context.Context, v string) error {
+		processed = append(processed, v)
+		return nil
+	}, graceful.WithWorkerStarvationLimit(2))
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []string{"h1", "h2", "m1", "h3", "h4", "l1", "h5"}, processed)
+}
+
+func TestPriorityWorkerStopsOnContextCancel(t *testing.T) {
+	high := make(chan string)
+	low := make(chan string)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := graceful.PriorityWorker([]<-chan string{high, low}, func(ctx context.Context, v string) error {
+		cancel()
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(ctx) }()
+
+	low <- "l1"
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestPriorityWorkerStopsOnErrWorkerFailure(t *testing.T) {
+	high := fill("h1", "h2")
+
+	runner := graceful.PriorityWorker([]<-chan string{high}, func(ctx context.Context, v string) error {
+		return graceful.ErrWorkerFailure
+	})
+
+	assert.Equal(t, graceful.ErrWorkerFailure, runner(context.Background()))
+}
+
+// Test that a nil value of an interface type is handled instead of panicking.
+func TestPriorityWorkerNilInterfaceValue(t *testing.T) {
+	high := make(chan error)
+	low := make(chan error)
+
+	var handled []error
+	runner := graceful.PriorityWorker([]<-chan error{high, low}, func(ctx context.Context, v error) error {
+		handled = append(handled, v)
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner(context.Background()) }()
+
+	// unbuffered sends are picked up by the blocking wait
+	low <- nil
+	close(high)
+	close(low)
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []error{nil}, handled)
+}
@@ -0,0 +1,657 @@
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/rs/zerolog"
+)
+
+var ErrQueueClosed = eris.New("queue closed")
+
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs every enqueue and ack before returning.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs in the background, see WithQueueFsyncInterval.
+	FsyncInterval
+	// FsyncNever leaves syncing to the operating system, and to Close.
+	FsyncNever
+)
+
+const (
+	segmentExt  = ".wal"
+	ackFileName = "acks.log"
+	// length, checksum and sequence number
+	recordHeaderSize = 4 + 4 + 8
+)
+
+type durableQueue struct {
+	logger        *zerolog.Logger
+	segmentSize   int64
+	fsync         FsyncPolicy
+	fsyncInterval time.Duration
+	closeTimeout  time.Duration
+}
+
+type DurableQueueOpt func(*durableQueue)
+
+func WithQueueLogger(logger *zerolog.Logger) DurableQueueOpt {
+	return func(q *durableQueue) {
+		if logger != nil {
+			q.logger = logger
+		}
+	}
+}
+
+func WithQueueSegmentSize(size int64) DurableQueueOpt {
+	return func(q *durableQueue) {
+		if size > 0 {
+			q.segmentSize = size
+		}
+	}
+}
+
+func WithQueueFsync(policy FsyncPolicy) DurableQueueOpt {
+	return func(q *durableQueue) {
+		q.fsync = policy
+	}
+}
+
+func WithQueueFsyncInterval(interval time.Duration) DurableQueueOpt {
+	return func(q *durableQueue) {
+		if interval > 0 {
+			q.fsync = FsyncInterval
+			q.fsyncInterval = interval
+		}
+	}
+}
+
+// WithQueueShutdownTimeout sets how long Runner waits on shutdown for delivered
+// items to be acked or nacked before it closes the queue.
+func WithQueueShutdownTimeout(timeout time.Duration) DurableQueueOpt {
+	return func(q *durableQueue) {
+		if timeout > 0 {
+			q.closeTimeout = timeout
+		}
+	}
+}
+
+type queueRecord[T any] struct {
+	seq        uint64
+	segment    uint64
+	value      T
+	deliveries int
+}
+
+// DurableQueue is a local write-ahead-log queue. Items are appended to segment
+// files and acknowledgements to a separate ack log. A segment is deleted once
+// every item in it is acked, and unacked items are replayed when the queue is
+// opened again. It is a Source for SourceWorker.
+type DurableQueue[T any] struct {
+	dir string
+	cfg *durableQueue
+
+	mu         sync.Mutex
+	closed     bool
+	stopping   bool
+	dirty      bool
+	wait       chan struct{}
+	active     *os.File
+	activeID   uint64
+	activeSize int64
+	acks       *os.File
+	nextSeq    uint64
+	pending    []queueRecord[T]
+	inflight   int
+	unacked    map[uint64]int      // segment -> unacked items
+	segAcks    map[uint64][]uint64 // segment -> acked sequence numbers
+	stopSync   chan struct{}
+	syncDone   chan struct{}
+}
+
+func OpenDurableQueue[T any](dir string, opts ...DurableQueueOpt) (*DurableQueue[T], error) {
+	noop := zerolog.Nop()
+	cfg := &durableQueue{
+		logger:        &noop,
+		segmentSize:   64 << 20,
+		fsync:         FsyncAlways,
+		fsyncInterval: time.Second,
+		closeTimeout:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, eris.Wrap(err, "failed to create queue directory")
+	}
+
+	q := &DurableQueue[T]{
+		dir:     dir,
+		cfg:     cfg,
+		wait:    make(chan struct{}),
+		nextSeq: 1,
+		unacked: map[uint64]int{},
+		segAcks: map[uint64][]uint64{},
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+
+	if cfg.fsync == FsyncInterval {
+		q.stopSync = make(chan struct{})
+		q.syncDone = make(chan struct{})
+		go q.syncLoop()
+	}
+
+	return q, nil
+}
+
+func (q *DurableQueue[T]) replay() error {
+	acked, err := readAcks(filepath.Join(q.dir, ackFileName))
+	if err != nil {
+		return err
+	}
+
+	// sequence numbers must not be reused while an ack for them may linger
+	for seq := range acked {
+		q.nextSeq = max(q.nextSeq, seq+1)
+	}
+
+	ids, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := readSegment(q.segmentPath(id), func(seq uint64, payload []byte) error {
+			q.nextSeq = max(q.nextSeq, seq+1)
+			if _, ok := acked[seq]; ok {
+				q.segAcks[id] = append(q.segAcks[id], seq)
+				return nil
+			}
+
+			var value T
+			if err := json.Unmarshal(payload, &value); err != nil {
+				return eris.Wrapf(err, "failed to decode item %d", seq)
+			}
+			q.pending = append(q.pending, queueRecord[T]{seq: seq, segment: id, value: value})
+			q.unacked[id]++
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if q.unacked[id] == 0 {
+			if err := q.removeSegment(id); err != nil {
+				return err
+			}
+		}
+		q.activeID = id
+	}
+
+	if err := q.rewriteAcks(); err != nil {
+		return err
+	}
+
+	// never append behind a record that may have been torn by a crash
+	return q.rotate()
+}
+
+func (q *DurableQueue[T]) Enqueue(value T) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return eris.Wrap(err, "failed to encode item")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	size := int64(recordHeaderSize + len(payload))
+	if q.activeSize > 0 && q.activeSize+size > q.cfg.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	seq := q.nextSeq
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint64(record[8:16], seq)
+	copy(record[recordHeaderSize:], payload)
+
+	if _, err := q.active.Write(record); err != nil {
+		return eris.Wrap(err, "failed to append item")
+	}
+	if err := q.synced(q.active); err != nil {
+		return err
+	}
+
+	q.nextSeq++
+	q.activeSize += size
+	q.unacked[q.activeID]++
+	q.pending = append(q.pending, queueRecord[T]{seq: seq, segment: q.activeID, value: value})
+	q.notify()
+
+	return nil
+}
+
+func (q *DurableQueue[T]) Receive(ctx context.Context) (Message[T], error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		q.mu.Lock()
+		if q.closed || q.stopping {
+			q.mu.Unlock()
+			return nil, ErrSourceClosed
+		}
+		if len(q.pending) > 0 {
+			record := q.pending[0]
+			q.pending = q.pending[1:]
+			record.deliveries++
+			q.inflight++
+			q.mu.Unlock()
+
+			return &queueMessage[T]{queue: q, record: record}, nil
+		}
+		wait := q.wait
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-wait:
+		}
+	}
+}
+
+// Len reports the number of items waiting to be delivered.
+func (q *DurableQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+func (q *DurableQueue[T]) backlog() (int, int) {
+	return q.Len(), 0
+}
+
+// Close flushes the logs to disk. Items that are not acked by then are
+// replayed by the next OpenDurableQueue.
+func (q *DurableQueue[T]) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.notify()
+	q.mu.Unlock()
+
+	if q.stopSync != nil {
+		close(q.stopSync)
+		<-q.syncDone
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var errs []error
+	for _, f := range []*os.File{q.active, q.acks} {
+		if err := f.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return eris.Wrap(err, "failed to close queue")
+	}
+
+	return nil
+}
+
+// Runner closes the queue on shutdown, so the log is flushed before exit.
+// Deliveries stop first, and items already delivered get until the shutdown
+// timeout to be acked or nacked.
+func (q *DurableQueue[T]) Runner() Runner {
+	return func(ctx context.Context) error {
+		<-ctx.Done()
+
+		q.settle()
+		if err := q.Close(); err != nil {
+			return err
+		}
+
+		return ctx.Err()
+	}
+}
+
+// settle stops deliveries and waits for inflight items, up to the shutdown
+// timeout.
+func (q *DurableQueue[T]) settle() {
+	timer := time.NewTimer(q.cfg.closeTimeout)
+	defer timer.Stop()
+
+	q.mu.Lock()
+	q.stopping = true
+	q.notify()
+	for q.inflight > 0 {
+		wait := q.wait
+		q.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			q.cfg.logger.
+				Warn().
+				Int("inflight", q.inflightCount()).
+				Msg("closing queue with unsettled items")
+			return
+		}
+
+		q.mu.Lock()
+	}
+	q.mu.Unlock()
+}
+
+func (q *DurableQueue[T]) inflightCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.inflight
+}
+
+func (q *DurableQueue[T]) ack(record queueRecord[T]) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], record.seq)
+	if _, err := q.acks.Write(buf[:]); err != nil {
+		return eris.Wrap(err, "failed to append ack")
+	}
+	if err := q.synced(q.acks); err != nil {
+		return err
+	}
+
+	q.inflight--
+	if q.inflight == 0 {
+		q.notify()
+	}
+	q.unacked[record.segment]--
+	q.segAcks[record.segment] = append(q.segAcks[record.segment], record.seq)
+
+	if q.unacked[record.segment] == 0 && record.segment != q.activeID {
+		if err := q.removeSegment(record.segment); err != nil {
+			return err
+		}
+		return q.rewriteAcks()
+	}
+
+	return nil
+}
+
+func (q *DurableQueue[T]) nack(record queueRecord[T]) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	q.inflight--
+	q.pending = append(q.pending, record)
+	q.notify()
+
+	return nil
+}
+
+func (q *DurableQueue[T]) rotate() error {
+	if q.active != nil {
+		if err := q.active.Sync(); err != nil {
+			return eris.Wrap(err, "failed to sync segment")
+		}
+		if err := q.active.Close(); err != nil {
+			return eris.Wrap(err, "failed to close segment")
+		}
+		if q.unacked[q.activeID] == 0 && q.acks != nil {
+			if err := q.removeSegment(q.activeID); err != nil {
+				return err
+			}
+			if err := q.rewriteAcks(); err != nil {
+				return err
+			}
+		}
+	}
+
+	q.activeID++
+	f, err := os.OpenFile(q.segmentPath(q.activeID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return eris.Wrap(err, "failed to create segment")
+	}
+	q.active = f
+	q.activeSize = 0
+
+	return nil
+}
+
+func (q *DurableQueue[T]) removeSegment(id uint64) error {
+	if err := os.Remove(q.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+		return eris.Wrap(err, "failed to remove segment")
+	}
+	delete(q.unacked, id)
+	delete(q.segAcks, id)
+
+	q.cfg.logger.Debug().Uint64("segment", id).Msg("removed acknowledged segment")
+
+	return nil
+}
+
+// rewriteAcks compacts the ack log down to the acks of live segments.
+func (q *DurableQueue[T]) rewriteAcks() error {
+	path := filepath.Join(q.dir, ackFileName)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return eris.Wrap(err, "failed to create ack log")
+	}
+
+	w := bufio.NewWriter(f)
+	var buf [8]byte
+	for _, seqs := range q.segAcks {
+		for _, seq := range seqs {
+			binary.BigEndian.PutUint64(buf[:], seq)
+			_, _ = w.Write(buf[:])
+		}
+	}
+	if err := errors.Join(w.Flush(), f.Sync(), f.Close()); err != nil {
+		return eris.Wrap(err, "failed to write ack log")
+	}
+
+	if q.acks != nil {
+		if err := q.acks.Close(); err != nil {
+			return eris.Wrap(err, "failed to close ack log")
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return eris.Wrap(err, "failed to replace ack log")
+	}
+
+	q.acks, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return eris.Wrap(err, "failed to open ack log")
+	}
+
+	return nil
+}
+
+func (q *DurableQueue[T]) synced(f *os.File) error {
+	switch q.cfg.fsync {
+	case FsyncAlways:
+		if err := f.Sync(); err != nil {
+			return eris.Wrap(err, "failed to sync queue")
+		}
+	case FsyncInterval:
+		q.dirty = true
+	}
+
+	return nil
+}
+
+func (q *DurableQueue[T]) syncLoop() {
+	defer close(q.syncDone)
+
+	ticker := time.NewTicker(q.cfg.fsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stopSync:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty && !q.closed {
+				if err := errors.Join(q.active.Sync(), q.acks.Sync()); err != nil {
+					q.cfg.logger.
+						Error().
+						Any("error", eris.ToJSON(eris.Wrap(err, "failed to sync queue"), true)).
+						Msg("queue sync failed")
+				}
+				q.dirty = false
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+func (q *DurableQueue[T]) notify() {
+	close(q.wait)
+	q.wait = make(chan struct{})
+}
+
+func (q *DurableQueue[T]) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+type queueMessage[T any] struct {
+	queue  *DurableQueue[T]
+	record queueRecord[T]
+	once   sync.Once
+	err    error
+}
+
+func (m *queueMessage[T]) Value() T        { return m.record.value }
+func (m *queueMessage[T]) Deliveries() int { return m.record.deliveries }
+
+func (m *queueMessage[T]) Ack() error {
+	m.once.Do(func() { m.err = m.queue.ack(m.record) })
+	return m.err
+}
+
+func (m *queueMessage[T]) Nack() error {
+	m.once.Do(func() { m.err = m.queue.nack(m.record) })
+	return m.err
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to list segments")
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// readSegment calls fn for every intact record and stops at the first torn or
+// corrupted one.
+func readSegment(path string, fn func(seq uint64, payload []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return eris.Wrap(err, "failed to open segment")
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [recordHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return nil
+		}
+
+		if err := fn(binary.BigEndian.Uint64(header[8:16]), payload); err != nil {
+			return err
+		}
+	}
+}
+
+func readAcks(path string) (map[uint64]struct{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[uint64]struct{}{}, nil
+		}
+		return nil, eris.Wrap(err, "failed to read ack log")
+	}
+
+	acked := make(map[uint64]struct{}, len(data)/8)
+	for i := 0; i+8 <= len(data); i += 8 {
+		acked[binary.BigEndian.Uint64(data[i:i+8])] = struct{}{}
+	}
+
+	return acked, nil
+}
@@ -0,0 +1,184 @@
+package graceful_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type job struct {
+	ID string `json:"id"`
+}
+
+func receive(t *testing.T, q *graceful.DurableQueue[job]) graceful.Message[job] {
+	t.Helper()
+
+	msg, err := q.Receive(context.Background())
+	require.NoError(t, err)
+	return msg
+}
+
+func TestDurableQueueDeliversInOrder(t *testing.T) {
+	q, err := graceful.OpenDurableQueue[job](t.TempDir())
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Enqueue(job{ID: "a"}))
+	require.NoError(t, q.Enqueue(job{ID: "b"}))
+
+	first := receive(t, q)
+	second := receive(t, q)
+	assert.Equal(t, "a", first.Value().ID)
+	assert.Equal(t, "b", second.Value().ID)
+	require.NoError(t, first.Ack())
+	require.NoError(t, second.Ack())
+	assert.Zero(t, q.Len())
+}
+
+func TestDurableQueueReplaysUnackedItems(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Enqueue(job{ID: id}))
+	}
+	require.NoError(t, receive(t, q).Ack())
+	_ = receive(t, q) // in flight when the process stops
+	require.NoError(t, q.Close())
+
+	q, err = graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, "b", receive(t, q).Value().ID)
+	assert.Equal(t, "c", receive(t, q).Value().ID)
+}
+
+func TestDurableQueueNackRedelivers(t *testing.T) {
+	q, err := graceful.OpenDurableQueue[job](t.TempDir())
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Enqueue(job{ID: "a"}))
+	require.NoError(t, receive(t, q).Nack())
+
+	msg := receive(t, q)
+	assert.Equal(t, "a", msg.Value().ID)
+	require.NoError(t, msg.Ack())
+}
+
+func TestDurableQueueCompactsAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := graceful.OpenDurableQueue[job](dir, graceful.WithQueueSegmentSize(64), graceful.WithQueueFsync(graceful.FsyncNever))
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, q.Enqueue(job{ID: id}))
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	require.Greater(t, len(segments), 2)
+
+	for range 4 {
+		require.NoError(t, receive(t, q).Ack())
+	}
+	require.NoError(t, q.Close())
+
+	remaining, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	assert.Less(t, len(remaining), len(segments))
+
+	q, err = graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, "e", receive(t, q).Value().ID)
+}
+
+func TestDurableQueueIgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(job{ID: "a"}))
+	require.NoError(t, q.Close())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	require.NotEmpty(t, segments)
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 9, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestDurableQueueRunnerClosesOnShutdown(t *testing.T) {
+	q, err := graceful.OpenDurableQueue[job](t.TempDir(), graceful.WithQueueFsyncInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, q.Enqueue(job{ID: "a"}))
+
+	var processed []string
+	worker := graceful.SourceWorker[job](q, func(ctx context.Context, j job) error {
+		processed = append(processed, j.ID)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 2)
+	go func() { errCh <- q.Runner()(ctx) }()
+	go func() { errCh <- worker(ctx) }()
+
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+
+	for range 2 {
+		assert.ErrorIs(t, <-errCh, context.Canceled)
+	}
+	assert.Equal(t, []string{"a"}, processed)
+	assert.ErrorIs(t, q.Enqueue(job{ID: "b"}), graceful.ErrQueueClosed)
+}
+
+func TestDurableQueueRunnerWaitsForAcks(t *testing.T) {
+	dir := t.TempDir()
+	q, err := graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Enqueue(job{ID: "a"}))
+
+	started := make(chan struct{})
+	worker := graceful.SourceWorker[job](q, func(ctx context.Context, j job) error {
+		close(started)
+		<-ctx.Done()
+		// finishing the item after shutdown still acks it
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	assert.ErrorIs(t, graceful.WaitContext(ctx, worker, q.Runner()), context.Canceled)
+
+	q, err = graceful.OpenDurableQueue[job](dir)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, 0, q.Len())
+}
@@ -0,0 +1,79 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket. A single limiter can be shared by several
+// runners, see WithWorkerLimiter and WithTickerLimiter.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+type RateLimiterOpt func(*RateLimiter)
+
+func WithRateLimiterClock(clock Clock) RateLimiterOpt {
+	return func(l *RateLimiter) {
+		if clock != nil {
+			l.clock = clock
+		}
+	}
+}
+
+// NewRateLimiter allows perSecond events on average and up to burst at once.
+func NewRateLimiter(perSecond float64, burst int, opts ...RateLimiterOpt) *RateLimiter {
+	if perSecond <= 0 || burst <= 0 {
+		panic("rate and burst must be greater than zero")
+	}
+
+	l := &RateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		clock:  realClock{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Wait blocks until an event is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	// reserve the token up front, so waiters are served in order
+	l.tokens--
+	if l.tokens >= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if err := sleep(ctx, l.clock, wait); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package graceful_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterAllowsBurstThenPaces(t *testing.T) {
+	limiter := graceful.NewRateLimiter(100, 3)
+	ctx := context.Background()
+
+	started := time.Now()
+	for range 3 {
+		require.NoError(t, limiter.Wait(ctx))
+	}
+	assert.Less(t, time.Since(started), 10*time.Millisecond)
+
+	for range 2 {
+		require.NoError(t, limiter.Wait(ctx))
+	}
+	assert.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond)
+}
+
+func TestRateLimiterWaitIsCancellable(t *testing.T) {
+	limiter := graceful.NewRateLimiter(1, 1)
+	require.NoError(t, limiter.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestWorkerRateLimit(t *testing.T) {
+	ch := make(chan int, 5)
+	for i := range 5 {
+		ch <- i
+	}
+	close(ch)
+
+	runner := graceful.Worker[int](ch, func(ctx context.Context, v int) error {
+		return nil
+	}, graceful.WithWorkerRateLimit(100, 1))
+
+	started := time.Now()
+	require.NoError(t, runner(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+}
+
+func TestWorkerRateLimitDrainsAfterShutdown(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
+	limiter := graceful.NewRateLimiter(1, 1, graceful.WithRateLimiterClock(clock))
+
+	ch := make(chan int, 10)
+	for i := range 10 {
+		ch <- i
+	}
+	close(ch)
+
+	var handled atomic.Int32
+	runner := graceful.Worker[int](ch, func(ctx context.Context, v int) error {
+		handled.Add(1)
+		return nil
+	}, graceful.WithWorkerLimiter(limiter), graceful.WithWorkerClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- runner(ctx) }()
+
+	var err error
+	require.Eventually(t, func() bool {
+		select {
+		case err = <-done:
+			return true
+		default:
+			clock.Advance(time.Second)
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, handled.Load())
+}
+
+func TestSharedLimiterAcrossRunners(t *testing.T) {
+	limiter := graceful.NewRateLimiter(100, 1)
+
+	first := make(chan int, 3)
+	second := make(chan int, 3)
+	for i := range 3 {
+		first <- i
+		second <- i
+	}
+	close(first)
+	close(second)
+
+	handler := func(ctx context.Context, v int) error { return nil }
+
+	started := time.Now()
+	err := graceful.WaitContext(context.Background(),
+		graceful.Worker[int](first, handler, graceful.WithWorkerLimiter(limiter)),
+		graceful.Worker[int](second, handler, graceful.WithWorkerLimiter(limiter)),
+	)
+	require.NoError(t, err)
+	// six items at 100/s with a burst of one, whichever worker takes them
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+}
+
+func TestTickerRateLimit(t *testing.T) {
+	var cnt int32
+	runner := func(ctx context.Context) error {
+		atomic.AddInt32(&cnt, 1)
+		return nil
+	}
+	ticker := graceful.Ticker(time.Millisecond, runner, graceful.WithTickerRateLimit(50, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, ticker(ctx), context.DeadlineExceeded)
+	assert.LessOrEqual(t, atomic.LoadInt32(&cnt), int32(7))
+}
+
+func TestNewRateLimiterInvalid(t *testing.T) {
+	assert.Panics(t, func() { graceful.NewRateLimiter(0, 1) })
+	assert.Panics(t, func() { graceful.NewRateLimiter(1, 0) })
+}
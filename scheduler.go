@@ -0,0 +1,286 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+var (
+	ErrTaskNotFound       = eris.New("task not found")
+	ErrTaskExists         = eris.New("task already exists")
+	ErrScheduleNotRunning = eris.New("schedule not running")
+)
+
+// Scheduler is a schedule that can be inspected and steered while it runs.
+type Scheduler struct {
+	cfg *schedule
+
+	mu   sync.Mutex
+	jobs []*job
+	run  *scheduleRun
+}
+
+// TaskInfo describes a task of a Scheduler and its latest run.
+type TaskInfo struct {
+	Name string
+	Spec string
+	// Next is the next activation, zero if the spec never fires again.
+	Next time.Time
+	// Prev is the start of the latest run, zero if the task did not run yet.
+	Prev         time.Time
+	LastDuration time.Duration
+	LastError    error
+	Running      int
+	Skipped      int64
+	Paused       bool
+}
+
+// NewScheduler is NewSchedule returning a handle on the schedule. Tasks
+// sharing a name are told apart by a #2, #3, ... suffix.
+func NewScheduler(opts ...ScheduleOpt) (*Scheduler, error) {
+	cfg := newSchedule(opts)
+
+	s := &Scheduler{cfg: cfg}
+	var errs []error
+	for _, job := range cfg.jobs {
+		if err := cfg.prepare(job); err != nil {
+			errs = append(errs, eris.Wrapf(err, "task %s", job.name))
+			continue
+		}
+		job.name = s.uniqueName(job.name)
+		s.jobs = append(s.jobs, job)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Run is the Runner of the schedule. It must not be called again while it
+// is running.
+func (s *Scheduler) Run(ctx context.Context) error {
+	// runs outlive the schedule up to the shutdown timeout, their context is
+	// cancelled on the first fatal error or once the schedule gave up on them
+	runCtx, fail := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer fail(nil)
+	loopCtx, stopLoops := context.WithCancel(ctx)
+	defer stopLoops()
+	defer context.AfterFunc(runCtx, stopLoops)()
+
+	run := &scheduleRun{cfg: s.cfg, ctx: runCtx, stopping: loopCtx, fail: fail}
+
+	s.mu.Lock()
+	if s.run != nil {
+		s.mu.Unlock()
+		return eris.New("schedule is already running")
+	}
+	s.run = run
+	for _, job := range s.jobs {
+		run.spawn(job)
+	}
+	s.mu.Unlock()
+
+	<-loopCtx.Done()
+
+	// no run starts once the schedule is stopping
+	s.mu.Lock()
+	s.run = nil
+	s.mu.Unlock()
+	run.loops.Wait()
+
+	err := s.cfg.drain(&run.runs, fail)
+	if cause := context.Cause(runCtx); eris.Is(cause, ErrScheduleFailure) {
+		return cause
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// Add registers the task under id, which names it instead of its Name method.
+// On a running scheduler the task starts right away, catching up missed runs
+// like the tasks registered on start.
+func (s *Scheduler) Add(id string, task Task) error {
+	return s.add(id, newJob(task, plainTask{task}))
+}
+
+func (s *Scheduler) AddContext(id string, task ContextTask) error {
+	return s.add(id, newJob(task, task))
+}
+
+// Update replaces the task registered under id, keeping it paused if it was.
+// A run of the previous task in flight is not interrupted.
+func (s *Scheduler) Update(id string, task Task) error {
+	return s.update(id, newJob(task, plainTask{task}))
+}
+
+func (s *Scheduler) UpdateContext(id string, task ContextTask) error {
+	return s.update(id, newJob(task, task))
+}
+
+// Remove unregisters the task registered under id. A run in flight is not
+// interrupted, and is still awaited on shutdown.
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	s.jobs = slices.DeleteFunc(s.jobs, func(j *job) bool { return j == removed })
+	s.retire(removed)
+
+	return nil
+}
+
+func (s *Scheduler) add(id string, job *job) error {
+	job.name = id
+	if err := s.cfg.prepare(job); err != nil {
+		return eris.Wrapf(err, "task %s", id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.find(id); err == nil {
+		return eris.Wrapf(ErrTaskExists, "task %s", id)
+	}
+	s.jobs = append(s.jobs, job)
+	if s.run != nil {
+		s.run.spawn(job)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) update(id string, job *job) error {
+	job.name = id
+	if err := s.cfg.prepare(job); err != nil {
+		return eris.Wrapf(err, "task %s", id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	job.paused = old.isPaused()
+	job.guard = old.guard
+	s.jobs[slices.Index(s.jobs, old)] = job
+	s.retire(old)
+	if s.run != nil {
+		s.run.spawn(job)
+	}
+
+	return nil
+}
+
+// retire stops the activations of a job that is no longer registered.
+func (s *Scheduler) retire(job *job) {
+	job.removed.Store(true)
+	if s.run != nil && job.stop != nil {
+		job.stop()
+	}
+}
+
+// Tasks lists the tasks in the order they were registered.
+func (s *Scheduler) Tasks() []TaskInfo {
+	s.mu.Lock()
+	jobs := slices.Clone(s.jobs)
+	s.mu.Unlock()
+
+	now := s.cfg.clock.Now()
+	infos := make([]TaskInfo, 0, len(jobs))
+	for _, job := range jobs {
+		job.mu.Lock()
+		infos = append(infos, TaskInfo{
+			Name:         job.name,
+			Spec:         job.task.Spec(),
+			Next:         job.schedule.Next(now),
+			Prev:         job.prev,
+			LastDuration: job.duration,
+			LastError:    job.lastErr,
+			Running:      int(job.running.Load()),
+			Skipped:      job.skipped.Load(),
+			Paused:       job.paused,
+		})
+		job.mu.Unlock()
+	}
+
+	return infos
+}
+
+// Trigger runs the task now, following its overlap policy, even when it is
+// paused. The run is not recorded in the job store.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.find(name)
+	if err != nil {
+		return err
+	}
+	if s.run == nil {
+		return eris.Wrapf(ErrScheduleNotRunning, "cannot trigger task %s", name)
+	}
+
+	s.cfg.logger.Info().Str("task", name).Msg("task triggered")
+	s.run.start(job, time.Time{})
+
+	return nil
+}
+
+// Pause skips the activations of the task until it is resumed. Runs in
+// flight are not affected.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	job, err := s.find(name)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	job.mu.Lock()
+	job.paused = paused
+	job.mu.Unlock()
+
+	return nil
+}
+
+func (s *Scheduler) find(name string) (*job, error) {
+	i := slices.IndexFunc(s.jobs, func(j *job) bool { return j.name == name })
+	if i < 0 {
+		return nil, eris.Wrapf(ErrTaskNotFound, "task %s", name)
+	}
+
+	return s.jobs[i], nil
+}
+
+func (s *Scheduler) uniqueName(name string) string {
+	unique := name
+	for n := 2; slices.ContainsFunc(s.jobs, func(j *job) bool { return j.name == unique }); n++ {
+		unique = fmt.Sprintf("%s#%d", name, n)
+	}
+
+	return unique
+}
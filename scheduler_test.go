@@ -0,0 +1,287 @@
+package graceful_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiquidCats/graceful/v2"
+)
+
+// Test that the scheduler reports the schedule and the latest run of tasks.
+func TestSchedulerTasks(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := graceful.NewFakeClock(start)
+
+	ran := make(chan struct{})
+	failing := &namedTask{name: "billing", funcContextTask: funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		defer close(ran)
+		return fmt.Errorf("test error")
+	}}}
+	scheduler, err := graceful.NewScheduler(
+		graceful.WithScheduleContextTasks(failing),
+		graceful.WithScheduleTasks(&funcTask{spec: "0 * * * *"}, &funcTask{spec: "0 * * * *"}),
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLocation(time.UTC),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+
+	clock.BlockUntil(3)
+	clock.Advance(time.Minute)
+	<-ran
+
+	require.Eventually(t, func() bool {
+		return scheduler.Tasks()[0].LastError != nil
+	}, time.Second, time.Millisecond)
+
+	tasks := scheduler.Tasks()
+	require.Len(t, tasks, 3)
+	assert.Equal(t, "billing", tasks[0].Name)
+	assert.Equal(t, start.Add(time.Minute), tasks[0].Prev)
+	assert.Equal(t, start.Add(2*time.Minute), tasks[0].Next)
+	assert.ErrorContains(t, tasks[0].LastError, "test error")
+
+	assert.Equal(t, "0 * * * *", tasks[1].Name)
+	assert.Equal(t, "0 * * * *#2", tasks[2].Name)
+	assert.Equal(t, start.Add(time.Hour), tasks[2].Next)
+	assert.True(t, tasks[2].Prev.IsZero())
+}
+
+// Test that a triggered task runs right away, even while paused.
+func TestSchedulerTrigger(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 1)
+	task := &namedTask{name: "report", funcContextTask: funcContextTask{spec: "@daily", run: func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}}}
+	scheduler, err := graceful.NewScheduler(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, scheduler.Trigger("report"), graceful.ErrScheduleNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+	clock.BlockUntil(1)
+
+	require.NoError(t, scheduler.Pause("report"))
+	require.NoError(t, scheduler.Trigger("report"))
+	<-ran
+
+	assert.ErrorIs(t, scheduler.Trigger("unknown"), graceful.ErrTaskNotFound)
+}
+
+// Test that a paused task skips its activations until it is resumed.
+func TestSchedulerPauseResume(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 2)
+	task := &namedTask{name: "sync", funcContextTask: funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}}}
+	scheduler, err := graceful.NewScheduler(
+		graceful.WithScheduleContextTasks(task),
+		graceful.WithScheduleClock(clock),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+
+	require.NoError(t, scheduler.Pause("sync"))
+	assert.True(t, scheduler.Tasks()[0].Paused)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	assert.Empty(t, ran)
+
+	require.NoError(t, scheduler.Resume("sync"))
+	clock.Advance(time.Minute)
+	<-ran
+
+	assert.ErrorIs(t, scheduler.Pause("unknown"), graceful.ErrTaskNotFound)
+}
+
+// Test that tasks added to a running scheduler start right away.
+func TestSchedulerAdd(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	scheduler, err := graceful.NewScheduler(graceful.WithScheduleClock(clock))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		return !errors.Is(scheduler.Trigger("none"), graceful.ErrScheduleNotRunning)
+	}, time.Second, time.Millisecond)
+
+	ran := make(chan struct{}, 1)
+	require.NoError(t, scheduler.Add("tenant-1", &funcTask{spec: "@every 1m", run: func() { ran <- struct{}{} }}))
+	assert.ErrorIs(t, scheduler.Add("tenant-1", &funcTask{spec: "@every 1m"}), graceful.ErrTaskExists)
+	assert.ErrorIs(t, scheduler.Add("tenant-2", &funcTask{spec: "@weekdays"}), graceful.ErrInvalidSpec)
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-ran
+
+	tasks := scheduler.Tasks()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "tenant-1", tasks[0].Name)
+}
+
+// Test that a removed task stops being scheduled without interrupting its run.
+func TestSchedulerRemove(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	var runs atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan error)
+	task := &funcContextTask{spec: "@every 1m", run: func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		finished <- ctx.Err()
+		return nil
+	}}
+	scheduler, err := graceful.NewScheduler(graceful.WithScheduleClock(clock))
+	require.NoError(t, err)
+	require.NoError(t, scheduler.AddContext("report", task))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+
+	require.NoError(t, scheduler.Remove("report"))
+	assert.ErrorIs(t, scheduler.Remove("report"), graceful.ErrTaskNotFound)
+	assert.Empty(t, scheduler.Tasks())
+
+	clock.Advance(time.Hour)
+	close(release)
+	assert.NoError(t, <-finished)
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+// Test that an updated task runs on its new spec and stays paused.
+func TestSchedulerUpdate(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan string, 1)
+	send := func(v string) func() {
+		return func() {
+			select {
+			case ran <- v:
+			default:
+			}
+		}
+	}
+	scheduler, err := graceful.NewScheduler(graceful.WithScheduleClock(clock))
+	require.NoError(t, err)
+	require.NoError(t, scheduler.Add("report", &funcTask{spec: "@every 1h", run: send("old")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+	clock.BlockUntil(1)
+
+	require.NoError(t, scheduler.Pause("report"))
+	require.NoError(t, scheduler.Update("report", &funcTask{spec: "@every 1m", run: send("new")}))
+	assert.ErrorIs(t, scheduler.Update("unknown", &funcTask{spec: "@every 1m"}), graceful.ErrTaskNotFound)
+
+	tasks := scheduler.Tasks()
+	require.Len(t, tasks, 1)
+	assert.True(t, tasks[0].Paused)
+	assert.Equal(t, "@every 1m", tasks[0].Spec)
+
+	require.NoError(t, scheduler.Resume("report"))
+	var got string
+	// the loop of the new task starts shortly after the update
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		select {
+		case got = <-ran:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "new", got)
+}
+
+// Test that an updated task does not overlap a run of the task it replaced.
+func TestSchedulerUpdateKeepsOverlapGuard(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	ran := make(chan struct{}, 1)
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	scheduler, err := graceful.NewScheduler(
+		graceful.WithScheduleClock(clock),
+		graceful.WithScheduleLogger(&logger),
+		graceful.WithScheduleOverlap(graceful.ScheduleOverlapSkip),
+	)
+	require.NoError(t, err)
+	require.NoError(t, scheduler.Add("report", &funcTask{spec: "@every 1m", run: func() {
+		started <- struct{}{}
+		<-release
+	}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = scheduler.Run(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+
+	require.NoError(t, scheduler.Update("report", &funcTask{spec: "@every 1m", run: func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	}}))
+
+	// the old run is still active, so the new task skips its activations
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		return strings.Contains(buf.String(), "task still running, skipping run")
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, ran)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		select {
+		case <-ran:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
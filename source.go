@@ -0,0 +1,212 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rotisserie/eris"
+)
+
+var ErrSourceClosed = eris.New("source closed")
+
+type Message[T any] interface {
+	Value() T
+	Ack() error
+	Nack() error
+}
+
+type Source[T any] interface {
+	// Receive blocks until a message is available. It returns ErrSourceClosed
+	// once the source is exhausted.
+	Receive(ctx context.Context) (Message[T], error)
+}
+
+type chanSource[T any] struct {
+	ch <-chan T
+}
+
+// drainingSource is implemented by sources that SourceWorker keeps receiving
+// from after the runner context is cancelled, until they are exhausted.
+type drainingSource interface {
+	drains()
+}
+
+// backlogSource is implemented by sources that can report how many messages
+// are waiting, and out of how many they can hold. Zero capacity means
+// unbounded.
+type backlogSource interface {
+	backlog() (int, int)
+}
+
+// ChannelSource adapts a channel to a Source. Like Worker always did,
+// SourceWorker keeps draining the channel until it is closed, regardless of
+// the runner context.
+func ChannelSource[T any](ch <-chan T) Source[T] {
+	return &chanSource[T]{ch: ch}
+}
+
+func (s *chanSource[T]) Receive(ctx context.Context) (Message[T], error) {
+	select {
+	case value, ok := <-s.ch:
+		if !ok {
+			return nil, ErrSourceClosed
+		}
+		return chanMessage[T]{value: value}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *chanSource[T]) drains() {}
+
+func (s *chanSource[T]) backlog() (int, int) {
+	return len(s.ch), cap(s.ch)
+}
+
+type chanMessage[T any] struct {
+	value T
+}
+
+func (m chanMessage[T]) Value() T    { return m.value }
+func (m chanMessage[T]) Ack() error  { return nil }
+func (m chanMessage[T]) Nack() error { return nil }
+
+type memoryItem[T any] struct {
+	value      T
+	deliveries int
+}
+
+type MemorySource[T any] struct {
+	mu       sync.Mutex
+	items    []memoryItem[T]
+	inflight int
+	closed   bool
+	wait     chan struct{}
+	acked    []T
+	nacked   []T
+}
+
+// NewMemorySource returns an in-memory Source. Nacked messages are put back at
+// the end of the queue right away, so it gives at-least-once delivery like a
+// broker would. A handler that always fails gets the message redelivered
+// forever; bound it with WithWorkerMaxDeliveries or WithWorkerRedeliveryDelay.
+func NewMemorySource[T any](items ...T) *MemorySource[T] {
+	s := &MemorySource[T]{
+		wait: make(chan struct{}),
+	}
+	for _, value := range items {
+		s.items = append(s.items, memoryItem[T]{value: value})
+	}
+
+	return s
+}
+
+func (s *MemorySource[T]) Push(items ...T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, value := range items {
+		s.items = append(s.items, memoryItem[T]{value: value})
+	}
+	s.notify()
+}
+
+func (s *MemorySource[T]) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.notify()
+}
+
+func (s *MemorySource[T]) Acked() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]T(nil), s.acked...)
+}
+
+func (s *MemorySource[T]) Nacked() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]T(nil), s.nacked...)
+}
+
+func (s *MemorySource[T]) Receive(ctx context.Context) (Message[T], error) {
+	for {
+		// a cancelled receive must not hand out messages nacked during
+		// shutdown again
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		if len(s.items) > 0 {
+			item := s.items[0]
+			s.items = s.items[1:]
+			item.deliveries++
+			s.inflight++
+			s.mu.Unlock()
+
+			return &memoryMessage[T]{src: s, item: item}, nil
+		}
+		// a closed source is only exhausted once nothing can be nacked back
+		if s.closed && s.inflight == 0 {
+			s.mu.Unlock()
+			return nil, ErrSourceClosed
+		}
+		wait := s.wait
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-wait:
+		}
+	}
+}
+
+func (s *MemorySource[T]) backlog() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items), 0
+}
+
+func (s *MemorySource[T]) settle(item memoryItem[T], ack bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight--
+	if ack {
+		s.acked = append(s.acked, item.value)
+	} else {
+		s.nacked = append(s.nacked, item.value)
+		s.items = append(s.items, item)
+	}
+	s.notify()
+}
+
+func (s *MemorySource[T]) notify() {
+	close(s.wait)
+	s.wait = make(chan struct{})
+}
+
+type memoryMessage[T any] struct {
+	src  *MemorySource[T]
+	item memoryItem[T]
+	once sync.Once
+}
+
+func (m *memoryMessage[T]) Value() T        { return m.item.value }
+func (m *memoryMessage[T]) Deliveries() int { return m.item.deliveries }
+
+func (m *memoryMessage[T]) Ack() error {
+	m.once.Do(func() { m.src.settle(m.item, true) })
+	return nil
+}
+
+func (m *memoryMessage[T]) Nack() error {
+	m.once.Do(func() { m.src.settle(m.item, false) })
+	return nil
+}
@@ -0,0 +1,129 @@
+package graceful_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LiquidCats/graceful/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceWorkerAcksOnSuccess(t *testing.T) {
+	src := graceful.NewMemorySource(1, 2, 3)
+	src.Close()
+
+	var processed []int
+	runner := graceful.SourceWorker[int](src, func(ctx context.Context, v int) error {
+		processed = append(processed, v)
+		return nil
+	})
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []int{1, 2, 3}, processed)
+	assert.Equal(t, []int{1, 2, 3}, src.Acked())
+	assert.Empty(t, src.Nacked())
+}
+
+func TestSourceWorkerNacksAndRedelivers(t *testing.T) {
+	src := graceful.NewMemorySource(1, 2)
+	src.Close()
+
+	attempts := map[int]int{}
+	runner := graceful.SourceWorker[int](src, func(ctx context.Context, v int) error {
+		attempts[v]++
+		if v == 1 && attempts[v] == 1 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, []int{1}, src.Nacked())
+	assert.ElementsMatch(t, []int{1, 2}, src.Acked())
+	assert.Equal(t, 2, attempts[1])
+}
+
+func TestSourceWorkerNacksOnErrWorkerFailure(t *testing.T) {
+	src := graceful.NewMemorySource(1, 2)
+
+	runner := graceful.SourceWorker[int](src, func(ctx context.Context, v int) error {
+		return graceful.ErrWorkerFailure
+	})
+
+	assert.Equal(t, graceful.ErrWorkerFailure, runner(context.Background()))
+	assert.Equal(t, []int{1}, src.Nacked())
+	assert.Empty(t, src.Acked())
+}
+
+func TestSourceWorkerShutdownPolicy(t *testing.T) {
+	for name, tc := range map[string]struct {
+		policy graceful.WorkerShutdownPolicy
+		acked  int
+		nacked int
+	}{
+		"nack": {policy: graceful.WorkerShutdownNack, nacked: 1},
+		"ack":  {policy: graceful.WorkerShutdownAck, acked: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := graceful.NewMemorySource(1)
+			ctx, cancel := context.WithCancel(context.Background())
+
+			runner := graceful.SourceWorker[int](src, func(ctx context.Context, v int) error {
+				cancel()
+				<-ctx.Done()
+				return ctx.Err()
+			}, graceful.WithWorkerShutdownPolicy(tc.policy))
+
+			assert.ErrorIs(t, runner(ctx), context.Canceled)
+			assert.Len(t, src.Acked(), tc.acked)
+			assert.Len(t, src.Nacked(), tc.nacked)
+		})
+	}
+}
+
+func TestSourceWorkerDropsAfterMaxDeliveries(t *testing.T) {
+	src := graceful.NewMemorySource(1)
+	src.Close()
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	var calls int
+	runner := graceful.SourceWorker[int](src, func(ctx context.Context, v int) error {
+		calls++
+		return errors.New("database is down")
+	},
+		graceful.WithWorkerMaxDeliveries(3),
+		graceful.WithWorkerRedeliveryDelay(time.Millisecond),
+		graceful.WithWorkerLogger(&logger),
+	)
+
+	require.NoError(t, runner(context.Background()))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 1}, src.Nacked())
+	assert.Equal(t, []int{1}, src.Acked())
+	assert.Contains(t, buf.String(), "dropping message after max deliveries")
+}
+
+func TestMemorySourceReceiveWaitsForPush(t *testing.T) {
+	src := graceful.NewMemorySource[int]()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		src.Push(7)
+	}()
+
+	msg, err := src.Receive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 7, msg.Value())
+	require.NoError(t, msg.Ack())
+
+	src.Close()
+	_, err = src.Receive(context.Background())
+	assert.ErrorIs(t, err, graceful.ErrSourceClosed)
+}
@@ -2,6 +2,8 @@ package graceful
 
 import (
 	"context"
+	"math/rand/v2"
+	"sync"
 	"time"
 
 	"github.com/rotisserie/eris"
@@ -10,8 +12,51 @@ import (
 
 var ErrTickerFailure = eris.New("ticker failure")
 
+type TickerOverlap int
+
+const (
+	// TickerOverlapSkip drops ticks while a run is active.
+	TickerOverlapSkip TickerOverlap = iota
+	// TickerOverlapQueueOne remembers a single tick while a run is active and
+	// runs again as soon as it finishes.
+	TickerOverlapQueueOne
+	// TickerOverlapConcurrent starts runs in parallel, up to the limit set by
+	// WithTickerConcurrentRuns.
+	TickerOverlapConcurrent
+)
+
+type TickerCatchUp int
+
+const (
+	// TickerCatchUpOnce collapses ticks missed while the process was paused or
+	// overloaded into a single run.
+	TickerCatchUpOnce TickerCatchUp = iota
+	// TickerCatchUpAll runs once for every missed tick, back to back.
+	TickerCatchUpAll
+	// TickerCatchUpNone drops missed ticks and waits for the next one.
+	TickerCatchUpNone
+)
+
 type ticker struct {
-	logger *zerolog.Logger
+	logger  *zerolog.Logger
+	breaker *breakerConfig
+	limiter *RateLimiter
+
+	initialDelay   time.Duration
+	jitterFraction float64
+	jitterDuration time.Duration
+	random         func() float64
+
+	overlap        TickerOverlap
+	concurrentRuns int
+
+	runOnStart bool
+	alignment  *alignment
+	catchUp    TickerCatchUp
+
+	finalRunTimeout time.Duration
+
+	clock Clock
 }
 
 type TickerOpt func(*ticker)
@@ -24,41 +69,413 @@ func WithTickerLogger(logger *zerolog.Logger) TickerOpt {
 	}
 }
 
+// WithTickerCircuitBreaker skips ticks for openFor after threshold
+// consecutive runner failures, then lets one run through as a probe. When the
+// breaker stays open for longer than maxOpen the ticker fails with
+// ErrCircuitOpen; zero maxOpen never escalates.
+func WithTickerCircuitBreaker(threshold int, openFor, maxOpen time.Duration) TickerOpt {
+	return func(t *ticker) {
+		if threshold > 0 && openFor > 0 {
+			t.breaker = &breakerConfig{threshold: threshold, openFor: openFor, maxOpen: maxOpen}
+		}
+	}
+}
+
+// WithTickerRateLimit limits the runner to perSecond runs, with bursts of up
+// to burst runs.
+func WithTickerRateLimit(perSecond float64, burst int) TickerOpt {
+	limiter := NewRateLimiter(perSecond, burst)
+	return func(t *ticker) {
+		t.limiter = limiter
+	}
+}
+
+// WithTickerLimiter limits the runner with a limiter that can be shared with
+// other runners.
+func WithTickerLimiter(limiter *RateLimiter) TickerOpt {
+	return func(t *ticker) {
+		t.limiter = limiter
+	}
+}
+
+// WithTickerRunOnStart runs the runner as soon as the ticker starts, instead
+// of after the first interval.
+func WithTickerRunOnStart() TickerOpt {
+	return func(t *ticker) {
+		t.initialDelay = 0
+		t.runOnStart = true
+	}
+}
+
+// WithTickerInitialDelay sets the delay before the first run, which defaults
+// to the interval.
+func WithTickerInitialDelay(delay time.Duration) TickerOpt {
+	return func(t *ticker) {
+		if delay >= 0 {
+			t.initialDelay = delay
+		}
+	}
+}
+
+// WithTickerJitter delays every tick by a random share of the interval, up to
+// fraction of it.
+func WithTickerJitter(fraction float64) TickerOpt {
+	return func(t *ticker) {
+		if fraction > 0 && fraction <= 1 {
+			t.jitterFraction = fraction
+			t.jitterDuration = 0
+		}
+	}
+}
+
+// WithTickerJitterDuration delays every tick by a random duration up to max,
+// but never by a whole interval, so a tick cannot run into the next one.
+func WithTickerJitterDuration(max time.Duration) TickerOpt {
+	return func(t *ticker) {
+		if max > 0 {
+			t.jitterDuration = max
+			t.jitterFraction = 0
+		}
+	}
+}
+
+// WithTickerRandSource sets the source of the jitter, for deterministic tests.
+func WithTickerRandSource(src rand.Source) TickerOpt {
+	return func(t *ticker) {
+		if src != nil {
+			t.random = rand.New(src).Float64
+		}
+	}
+}
+
+func WithTickerOverlap(policy TickerOverlap) TickerOpt {
+	return func(t *ticker) {
+		t.overlap = policy
+	}
+}
+
+// WithTickerConcurrentRuns allows up to n runs at once, see
+// TickerOverlapConcurrent.
+func WithTickerConcurrentRuns(n int) TickerOpt {
+	return func(t *ticker) {
+		if n > 0 {
+			t.overlap = TickerOverlapConcurrent
+			t.concurrentRuns = n
+		}
+	}
+}
+
+// WithTickerAlignment fires the ticker on multiples of the interval since
+// epoch, in loc, instead of relative to its start. A zero epoch means
+// midnight of 1 January 2000 in loc. Intervals that divide a day keep to the
+// same local times across DST changes. WithTickerInitialDelay does not apply to
+// aligned tickers.
+func WithTickerAlignment(epoch time.Time, loc *time.Location) TickerOpt {
+	return func(t *ticker) {
+		if loc == nil {
+			loc = time.Local
+		}
+		t.alignment = &alignment{epoch: epoch, loc: loc}
+	}
+}
+
+func WithTickerCatchUp(policy TickerCatchUp) TickerOpt {
+	return func(t *ticker) {
+		t.catchUp = policy
+	}
+}
+
+// WithTickerFinalRun runs the runner one last time on shutdown, once the
+// other runs finished, with a fresh context bounded by timeout. An error of
+// the final run is returned by the ticker.
+func WithTickerFinalRun(timeout time.Duration) TickerOpt {
+	return func(t *ticker) {
+		if timeout > 0 {
+			t.finalRunTimeout = timeout
+		}
+	}
+}
+
+// WithTickerClock sets the clock driving the ticker, its circuit breaker and
+// its final run timeout.
+func WithTickerClock(clock Clock) TickerOpt {
+	return func(t *ticker) {
+		if clock != nil {
+			t.clock = clock
+		}
+	}
+}
+
 func Ticker(interval time.Duration, runner Runner, opts ...TickerOpt) Runner {
 	if interval <= 0 {
 		panic("interval must be greater than zero")
 	}
 
-	noop := zerolog.Nop()
-	cfg := &ticker{
-		logger: &noop,
-	}
-	for _, opt := range opts {
-		opt(cfg)
+	cfg := newTicker(interval, opts)
+
+	limit := 1
+	if cfg.overlap == TickerOverlapConcurrent {
+		limit = max(cfg.concurrentRuns, 1)
 	}
 
 	return func(ctx context.Context) error {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+		breaker := newBreaker(cfg.breaker, cfg.clock.Now)
 
 		cfg.logger.Info().Msg("starting ticker")
 		defer cfg.logger.Info().Msg("stopped ticker")
 
+		// runs are cancelled on a fatal error of any of them, and the ticker
+		// only returns once they all finished
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		runCtx, cancelRuns := context.WithCancel(ctx)
+		defer cancelRuns()
+
+		finished := make(chan error, limit)
+		active, pending, skipped := 0, 0, 0
+		start := func() {
+			active++
+			wg.Go(func() {
+				finished <- cfg.run(runCtx, breaker, runner)
+			})
+		}
+		tick := func(catchUp bool) {
+			switch {
+			case active < limit:
+				start()
+			case catchUp:
+				pending++
+			case cfg.overlap == TickerOverlapQueueOne && pending == 0:
+				pending = 1
+			default:
+				skipped++
+				cfg.logger.
+					Warn().
+					Int("active", active).
+					Int("skipped", skipped).
+					Msg("runner still active, skipping tick")
+			}
+		}
+
+		// ticks are scheduled on a fixed grid, and jitter only shifts a single
+		// tick, so it never accumulates
+		now := cfg.clock.Now()
+		due := now.Add(cfg.initialDelay)
+		if cfg.alignment != nil && !cfg.runOnStart {
+			due = cfg.alignment.next(now, interval)
+		}
+		timer := cfg.clock.NewTimer(due.Sub(now))
+		defer timer.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
-			case <-ticker.C:
-				if err := runner(ctx); err != nil {
-					if eris.Is(err, ErrTickerFailure) {
+				cancelRuns()
+				wg.Wait()
+				// a fatal error of a run that finished along with the
+				// shutdown wins over the final run
+				for range active {
+					if err := <-finished; err != nil {
 						return err
 					}
+				}
+				return cfg.finalRun(ctx, runner)
+			case err := <-finished:
+				active--
+				if err != nil {
+					return err
+				}
+				if pending > 0 {
+					pending--
+					start()
+				}
+			case <-timer.C():
+				now := cfg.clock.Now()
+
+				next, missed := cfg.nextTick(due, interval), 0
+				for !next.After(now) {
+					missed++
+					next = cfg.nextTick(next, interval)
+				}
+				if missed > 0 {
 					cfg.logger.
-						Error().
-						Any("error", eris.ToJSON(err, true)).
-						Msg("runner failed")
+						Warn().
+						Int("missed", missed).
+						Msg("ticker missed ticks")
+				}
+
+				switch {
+				case missed == 0 || cfg.catchUp == TickerCatchUpOnce:
+					tick(false)
+				case cfg.catchUp == TickerCatchUpAll:
+					for i := range missed + 1 {
+						tick(i > 0)
+					}
 				}
+
+				due = next
+				timer.Reset(due.Add(cfg.jitter(interval)).Sub(now))
 			}
 		}
 	}
 }
+
+func (t *ticker) nextTick(after time.Time, interval time.Duration) time.Time {
+	if t.alignment != nil {
+		return t.alignment.next(after, interval)
+	}
+
+	return after.Add(interval)
+}
+
+type DynamicRunner func(ctx context.Context) (time.Duration, error)
+
+// DynamicTicker runs the runner again after the delay it returns, measured
+// from the end of the run. When the runner returns no delay, or the run is
+// skipped by the circuit breaker, the previous delay is kept; initial is used
+// before the first run. Runs never overlap, so WithTickerOverlap does not
+// apply.
+func DynamicTicker(initial time.Duration, runner DynamicRunner, opts ...TickerOpt) Runner {
+	if initial <= 0 {
+		panic("initial delay must be greater than zero")
+	}
+
+	cfg := newTicker(initial, opts)
+
+	return func(ctx context.Context) error {
+		breaker := newBreaker(cfg.breaker, cfg.clock.Now)
+
+		cfg.logger.Info().Msg("starting ticker")
+		defer cfg.logger.Info().Msg("stopped ticker")
+
+		delay := initial
+		timer := cfg.clock.NewTimer(cfg.initialDelay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return cfg.finalRun(ctx, func(ctx context.Context) error {
+					_, err := runner(ctx)
+					return err
+				})
+			case <-timer.C():
+				var next time.Duration
+				err := cfg.run(ctx, breaker, func(ctx context.Context) error {
+					var err error
+					next, err = runner(ctx)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				if next > 0 {
+					delay = next
+				}
+
+				timer.Reset(delay + cfg.jitter(delay))
+			}
+		}
+	}
+}
+
+type AdaptiveRunner func(ctx context.Context) (bool, error)
+
+// AdaptiveTicker starts polling every fastest. Each run that reports work was
+// done halves the interval, down to fastest, and each idle or failed run
+// doubles it, up to slowest.
+func AdaptiveTicker(fastest, slowest time.Duration, runner AdaptiveRunner, opts ...TickerOpt) Runner {
+	if fastest <= 0 || slowest < fastest {
+		panic("adaptive bounds must satisfy 0 < fastest <= slowest")
+	}
+
+	return func(ctx context.Context) error {
+		delay := fastest
+
+		return DynamicTicker(fastest, func(ctx context.Context) (time.Duration, error) {
+			worked, err := runner(ctx)
+			if err == nil && worked {
+				delay = max(delay/2, fastest)
+			} else {
+				delay = min(delay*2, slowest)
+			}
+			return delay, err
+		}, opts...)(ctx)
+	}
+}
+
+func newTicker(interval time.Duration, opts []TickerOpt) *ticker {
+	noop := zerolog.Nop()
+	cfg := &ticker{
+		logger:       &noop,
+		initialDelay: interval,
+		random:       rand.Float64,
+		overlap:      TickerOverlapSkip,
+		clock:        realClock{},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func (t *ticker) finalRun(ctx context.Context, runner Runner) error {
+	if t.finalRunTimeout <= 0 {
+		return ctx.Err()
+	}
+
+	finalCtx, cancel := withTimeout(context.WithoutCancel(ctx), t.clock, t.finalRunTimeout)
+	defer cancel()
+
+	t.logger.Info().Msg("final run")
+	if err := runner(finalCtx); err != nil {
+		return eris.Wrap(err, "final run failed")
+	}
+
+	return ctx.Err()
+}
+
+func (t *ticker) jitter(interval time.Duration) time.Duration {
+	limit := t.jitterDuration
+	if t.jitterFraction > 0 {
+		limit = time.Duration(float64(interval) * t.jitterFraction)
+	}
+	limit = min(limit, interval)
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(t.random() * float64(limit))
+}
+
+// run calls the runner once, guarded by the circuit breaker and the rate
+// limiter. It only returns fatal errors.
+func (t *ticker) run(ctx context.Context, breaker *breaker, runner Runner) error {
+	if breaker.acquire() > 0 {
+		t.logger.Debug().Msg("circuit breaker open, skipping run")
+		return nil
+	}
+
+	if err := t.limiter.Wait(ctx); err != nil {
+		// the run was still waiting for its turn at shutdown, the final run
+		// takes over
+		t.logger.Debug().Msg("shutting down, skipping run waiting for the rate limiter")
+		return nil
+	}
+
+	err := runner(ctx)
+	if err == nil {
+		breaker.success()
+		return nil
+	}
+	if eris.Is(err, ErrTickerFailure) {
+		return err
+	}
+	t.logger.
+		Error().
+		Any("error", eris.ToJSON(err, true)).
+		Msg("runner failed")
+
+	return breaker.failure()
+}
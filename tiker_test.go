@@ -8,21 +8,26 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/LiquidCats/graceful/v2"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Test that the ticker invokes the runner at the specified interval.
 func TestTickerRunsAtInterval(t *testing.T) {
 	interval := 5 * time.Millisecond
+	clock := graceful.NewFakeClock(time.Now())
 	var cnt int32
+	ran := make(chan struct{}, 5)
 	runner := func(ctx context.Context) error {
 		atomic.AddInt32(&cnt, 1)
+		ran <- struct{}{}
 		return nil
 	}
-	ticker := graceful.Ticker(interval, runner)
+	ticker := graceful.Ticker(interval, runner, graceful.WithTickerClock(clock))
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -33,11 +38,15 @@ func TestTickerRunsAtInterval(t *testing.T) {
 	})
 
 	// Let the ticker run a few times
-	time.Sleep(30 * time.Millisecond)
+	for range 5 {
+		clock.BlockUntil(1)
+		clock.Advance(interval)
+		<-ran
+	}
 	cancel()
 	wg.Wait()
-	// Expect at least 5 ticks (interval 5ms * 5 = 25ms)
-	assert.GreaterOrEqual(t, atomic.LoadInt32(&cnt), int32(5))
+	// Expect exactly one tick per elapsed interval
+	assert.Equal(t, int32(5), atomic.LoadInt32(&cnt))
 }
 
 // Test that a runner returning ErrTickerFailure causes the ticker to stop with that error.
@@ -65,9 +74,12 @@ func TestTickerErrTickerFailure(t *testing.T) {
 // Test that non-failure errors are logged and the ticker continues.
 func TestTickerNonFailureErrorLogged(t *testing.T) {
 	interval := 5 * time.Millisecond
+	clock := graceful.NewFakeClock(time.Now())
 	var tickCnt int32
+	ran := make(chan struct{}, 4)
 	// First tick errors, subsequent ticks succeed
 	runner := func(ctx context.Context) error {
+		defer func() { ran <- struct{}{} }()
 		atomic.AddInt32(&tickCnt, 1)
 		if atomic.LoadInt32(&tickCnt) == 1 {
 			return fmt.Errorf("test error")
@@ -76,7 +88,13 @@ func TestTickerNonFailureErrorLogged(t *testing.T) {
 	}
 	var buf bytes.Buffer
 	logger := zerolog.New(&buf)
-	ticker := graceful.Ticker(interval, runner, graceful.WithTickerLogger(&logger))
+	// a run signals before the ticker sees it finish, the next tick is queued
+	// rather than skipped
+	ticker := graceful.Ticker(interval, runner,
+		graceful.WithTickerLogger(&logger),
+		graceful.WithTickerClock(clock),
+		graceful.WithTickerOverlap(graceful.TickerOverlapQueueOne),
+	)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
@@ -86,12 +104,16 @@ func TestTickerNonFailureErrorLogged(t *testing.T) {
 		_ = ticker(ctx)
 	}()
 
-	time.Sleep(20 * time.Millisecond)
+	for range 4 {
+		clock.BlockUntil(1)
+		clock.Advance(interval)
+		<-ran
+	}
 	cancel()
 	wg.Wait()
 
-	// The ticker should have run at least 4 times
-	assert.GreaterOrEqual(t, atomic.LoadInt32(&tickCnt), int32(4))
+	// The ticker should have run exactly 4 times
+	assert.Equal(t, int32(4), atomic.LoadInt32(&tickCnt))
 	logs := buf.String()
 	assert.Contains(t, logs, "runner failed")
 	assert.Contains(t, logs, "test error")
@@ -132,3 +154,579 @@ func TestTickerWithLogger(t *testing.T) {
 	assert.Contains(t, logs, "starting ticker")
 	assert.Contains(t, logs, "stopped ticker")
 }
+
+// Test that an open circuit breaker skips ticks and escalates once it stays open too long.
+func TestTickerCircuitBreaker(t *testing.T) {
+	interval := 5 * time.Millisecond
+	var cnt int32
+	runner := func(ctx context.Context) error {
+		atomic.AddInt32(&cnt, 1)
+		return fmt.Errorf("database is down")
+	}
+	ticker := graceful.Ticker(interval, runner, graceful.WithTickerCircuitBreaker(2, 30*time.Millisecond, 50*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := ticker(ctx)
+	assert.ErrorIs(t, err, graceful.ErrCircuitOpen)
+	// without the breaker the runner would have run on nearly every tick
+	assert.Less(t, atomic.LoadInt32(&cnt), int32(10))
+}
+
+// Test that WithTickerRunOnStart runs before the first interval elapses.
+func TestTickerRunOnStart(t *testing.T) {
+	ran := make(chan time.Time, 1)
+	runner := func(ctx context.Context) error {
+		select {
+		case ran <- time.Now():
+		default:
+		}
+		return nil
+	}
+	ticker := graceful.Ticker(time.Hour, runner, graceful.WithTickerRunOnStart())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("runner did not run on start")
+	}
+}
+
+// Test that WithTickerInitialDelay replaces the interval before the first run.
+func TestTickerInitialDelay(t *testing.T) {
+	ran := make(chan time.Time, 1)
+	runner := func(ctx context.Context) error {
+		select {
+		case ran <- time.Now():
+		default:
+		}
+		return nil
+	}
+	ticker := graceful.Ticker(time.Hour, runner, graceful.WithTickerInitialDelay(20*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := time.Now()
+	go func() { _ = ticker(ctx) }()
+
+	select {
+	case at := <-ran:
+		assert.GreaterOrEqual(t, at.Sub(started), 20*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("runner did not run after the initial delay")
+	}
+}
+
+// halfSource makes every jitter exactly half of its maximum.
+type halfSource struct{}
+
+func (halfSource) Uint64() uint64 { return 1 << 52 }
+
+// Test that jitter comes from the injected random source.
+func TestTickerJitter(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 2)
+	runner := func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}
+	ticker := graceful.Ticker(20*time.Millisecond, runner,
+		graceful.WithTickerJitter(1),
+		graceful.WithTickerRandSource(halfSource{}),
+		graceful.WithTickerClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(20 * time.Millisecond)
+	<-ran
+
+	// 20ms interval plus 10ms jitter
+	clock.BlockUntil(1)
+	clock.Advance(20 * time.Millisecond)
+	clock.BlockUntil(1)
+	assert.Empty(t, ran)
+	clock.Advance(10 * time.Millisecond)
+	<-ran
+}
+
+// Test that a jitter longer than the interval is capped below it, so no tick
+// is reported as missed.
+func TestTickerJitterDurationCapped(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 2)
+	runner := func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	ticker := graceful.Ticker(20*time.Millisecond, runner,
+		graceful.WithTickerJitterDuration(time.Hour),
+		graceful.WithTickerRandSource(halfSource{}),
+		graceful.WithTickerClock(clock),
+		graceful.WithTickerLogger(&logger),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(20 * time.Millisecond)
+	<-ran
+
+	// 20ms interval plus half of the 20ms cap
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Millisecond)
+	<-ran
+
+	assert.NotContains(t, buf.String(), "ticker missed ticks")
+}
+
+// blockingRunner counts runs and blocks each of them until released.
+type blockingRunner struct {
+	runs    int32
+	active  int32
+	peak    int32
+	release chan struct{}
+}
+
+func (b *blockingRunner) run(ctx context.Context) error {
+	atomic.AddInt32(&b.runs, 1)
+	cur := atomic.AddInt32(&b.active, 1)
+	defer atomic.AddInt32(&b.active, -1)
+	for {
+		old := atomic.LoadInt32(&b.peak)
+		if cur <= old || atomic.CompareAndSwapInt32(&b.peak, old, cur) {
+			break
+		}
+	}
+
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// Test that ticks are skipped and logged while a run is active.
+func TestTickerOverlapSkip(t *testing.T) {
+	b := &blockingRunner{release: make(chan struct{})}
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf)
+	ticker := graceful.Ticker(2*time.Millisecond, b.run, graceful.WithTickerLogger(&logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ticker(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		return bytes.Contains([]byte(buf.String()), []byte("skipping tick"))
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b.runs))
+	assert.Contains(t, buf.String(), `"skipped":1`)
+}
+
+// Test that a tick arriving during a run is queued and run right after it.
+func TestTickerOverlapQueueOne(t *testing.T) {
+	b := &blockingRunner{release: make(chan struct{})}
+	ticker := graceful.Ticker(2*time.Millisecond, b.run, graceful.WithTickerOverlap(graceful.TickerOverlapQueueOne))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ticker(ctx) }()
+
+	// let several ticks pass during the first run
+	time.Sleep(20 * time.Millisecond)
+	b.release <- struct{}{}
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&b.runs) == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b.peak))
+}
+
+// Test that concurrent runs are capped at the configured limit.
+func TestTickerOverlapConcurrent(t *testing.T) {
+	b := &blockingRunner{release: make(chan struct{})}
+	ticker := graceful.Ticker(2*time.Millisecond, b.run, graceful.WithTickerConcurrentRuns(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ticker(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&b.active) == 2
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, int32(2), atomic.LoadInt32(&b.peak))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&b.active))
+}
+
+// Test that DynamicTicker waits for the delay returned by the runner.
+func TestDynamicTickerUsesReturnedDelay(t *testing.T) {
+	var runs []time.Time
+	done := make(chan struct{})
+	runner := func(ctx context.Context) (time.Duration, error) {
+		runs = append(runs, time.Now())
+		if len(runs) == 3 {
+			close(done)
+			<-ctx.Done()
+		}
+		return time.Duration(len(runs)) * 20 * time.Millisecond, nil
+	}
+	ticker := graceful.DynamicTicker(time.Millisecond, runner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ticker(ctx) }()
+
+	<-done
+	cancel()
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+
+	require.Len(t, runs, 3)
+	assert.GreaterOrEqual(t, runs[1].Sub(runs[0]), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, runs[2].Sub(runs[1]), 40*time.Millisecond)
+}
+
+// Test that AdaptiveTicker backs off while idle and speeds up when there is work.
+func TestAdaptiveTicker(t *testing.T) {
+	var runs []time.Time
+	done := make(chan struct{})
+	// idle, failing, idle, then work
+	runner := func(ctx context.Context) (bool, error) {
+		runs = append(runs, time.Now())
+		if len(runs) == 6 {
+			close(done)
+			<-ctx.Done()
+		}
+		if len(runs) == 2 {
+			return false, fmt.Errorf("test error")
+		}
+		return len(runs) > 3, nil
+	}
+	ticker := graceful.AdaptiveTicker(5*time.Millisecond, 20*time.Millisecond, runner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ticker(ctx) }()
+
+	<-done
+	cancel()
+	<-errCh
+
+	require.Len(t, runs, 6)
+	gaps := make([]time.Duration, 0, 5)
+	for i := 1; i < len(runs); i++ {
+		gaps = append(gaps, runs[i].Sub(runs[i-1]))
+	}
+	// 10ms, 20ms, 20ms (capped), then 10ms, 5ms
+	assert.GreaterOrEqual(t, gaps[1], 20*time.Millisecond)
+	assert.GreaterOrEqual(t, gaps[2], 20*time.Millisecond)
+	assert.Less(t, gaps[4], gaps[2])
+}
+
+// Test that an aligned ticker fires on multiples of the interval since the epoch.
+func TestTickerAlignment(t *testing.T) {
+	interval := 20 * time.Millisecond
+	epoch := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	ran := make(chan time.Time, 3)
+	runner := func(ctx context.Context) error {
+		select {
+		case ran <- time.Now():
+		default:
+		}
+		return nil
+	}
+	ticker := graceful.Ticker(interval, runner, graceful.WithTickerAlignment(epoch, time.UTC))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	for range 3 {
+		at := <-ran
+		// timers never fire early, so the offset past the boundary is small
+		assert.Less(t, at.Sub(epoch)%interval, 10*time.Millisecond)
+	}
+}
+
+// Test that the final run happens on shutdown with a live, bounded context.
+func TestTickerFinalRun(t *testing.T) {
+	var final atomic.Bool
+	runner := func(ctx context.Context) error {
+		if ctx.Err() == nil {
+			_, hasDeadline := ctx.Deadline()
+			final.Store(hasDeadline)
+		}
+		return nil
+	}
+	ticker := graceful.Ticker(time.Hour, runner, graceful.WithTickerFinalRun(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, ticker(ctx), context.Canceled)
+	assert.True(t, final.Load())
+}
+
+// Test that an error of the final run is returned by the ticker.
+func TestTickerFinalRunError(t *testing.T) {
+	runner := func(ctx context.Context) error {
+		return fmt.Errorf("flush failed")
+	}
+	ticker := graceful.Ticker(time.Hour, runner, graceful.WithTickerFinalRun(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ticker(ctx)
+	assert.ErrorContains(t, err, "flush failed")
+	assert.ErrorContains(t, err, "final run failed")
+}
+
+// Test that the final run of a dynamic ticker is bounded by its timeout.
+func TestDynamicTickerFinalRunTimeout(t *testing.T) {
+	runner := func(ctx context.Context) (time.Duration, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	ticker := graceful.DynamicTicker(time.Hour, runner, graceful.WithTickerFinalRun(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, ticker(ctx), context.DeadlineExceeded)
+}
+
+// Test that a ticker on a fake clock runs exactly once per elapsed interval.
+func TestTickerFakeClock(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ran := make(chan struct{}, 10)
+	runner := func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}
+	ticker := graceful.Ticker(time.Minute, runner, graceful.WithTickerClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ticker(ctx) }()
+
+	for range 3 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		<-ran
+	}
+	clock.BlockUntil(1)
+	clock.Advance(59 * time.Second)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, ran)
+}
+
+// Test that missed ticks are caught up according to the catch-up policy.
+func TestTickerCatchUp(t *testing.T) {
+	tests := []struct {
+		policy graceful.TickerCatchUp
+		runs   int
+	}{
+		{graceful.TickerCatchUpOnce, 1},
+		{graceful.TickerCatchUpAll, 3},
+		{graceful.TickerCatchUpNone, 0},
+	}
+	for _, tt := range tests {
+		clock := graceful.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+		var runs atomic.Int32
+		ran := make(chan struct{}, 10)
+		runner := func(ctx context.Context) error {
+			runs.Add(1)
+			ran <- struct{}{}
+			return nil
+		}
+		ticker := graceful.Ticker(time.Minute, runner,
+			graceful.WithTickerClock(clock),
+			graceful.WithTickerCatchUp(tt.policy),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- ticker(ctx) }()
+
+		// the ticker wakes up once, 2 ticks late
+		clock.BlockUntil(1)
+		clock.Advance(3*time.Minute + 30*time.Second)
+		for range tt.runs {
+			<-ran
+		}
+
+		// the next tick is back on the grid
+		clock.BlockUntil(1)
+		clock.Advance(30 * time.Second)
+		<-ran
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, int32(tt.runs+1), runs.Load(), "policy %d", tt.policy)
+	}
+}
+
+// Test that a daily aligned ticker stays at local midnight across a DST change.
+func TestTickerAlignmentDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// clocks spring forward on 10 March 2024, so that day lasts 23 hours
+	clock := graceful.NewFakeClock(time.Date(2024, time.March, 9, 12, 0, 0, 0, loc))
+
+	ran := make(chan time.Time, 2)
+	runner := func(ctx context.Context) error {
+		ran <- clock.Now()
+		return nil
+	}
+	ticker := graceful.Ticker(24*time.Hour, runner,
+		graceful.WithTickerClock(clock),
+		graceful.WithTickerAlignment(time.Time{}, loc),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(12 * time.Hour)
+	assert.Equal(t, time.Date(2024, time.March, 10, 0, 0, 0, 0, loc), (<-ran).In(loc))
+
+	clock.BlockUntil(1)
+	clock.Advance(23 * time.Hour)
+	assert.Equal(t, time.Date(2024, time.March, 11, 0, 0, 0, 0, loc), (<-ran).In(loc))
+}
+
+// Test that an aligned ticker with an interval shorter than a day keeps to the
+// local wall clock across a DST change.
+func TestTickerAlignmentDSTWallClock(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// clocks fall back on 3 November 2024, so that day lasts 25 hours
+	clock := graceful.NewFakeClock(time.Date(2024, time.November, 2, 20, 0, 0, 0, loc))
+
+	ran := make(chan time.Time, 3)
+	runner := func(ctx context.Context) error {
+		ran <- clock.Now()
+		return nil
+	}
+	ticker := graceful.Ticker(6*time.Hour, runner,
+		graceful.WithTickerClock(clock),
+		graceful.WithTickerAlignment(time.Time{}, loc),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ticker(ctx) }()
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    time.Time
+	}{
+		{4 * time.Hour, time.Date(2024, time.November, 3, 0, 0, 0, 0, loc)},
+		{7 * time.Hour, time.Date(2024, time.November, 3, 6, 0, 0, 0, loc)},
+		{6 * time.Hour, time.Date(2024, time.November, 3, 12, 0, 0, 0, loc)},
+	} {
+		clock.BlockUntil(1)
+		clock.Advance(step.advance)
+		assert.Equal(t, step.want, (<-ran).In(loc))
+	}
+}
+
+// Test that a fatal error of a run finishing during shutdown is not lost.
+func TestTickerFailureDuringShutdown(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
+
+	started := make(chan struct{}, 1)
+	runner := func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return graceful.ErrTickerFailure
+	}
+	ticker := graceful.Ticker(time.Minute, runner,
+		graceful.WithTickerClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ticker(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-started
+	cancel()
+
+	assert.ErrorIs(t, <-done, graceful.ErrTickerFailure)
+}
+
+// Test that a run waiting for the rate limiter at shutdown does not prevent
+// the final run.
+func TestTickerFinalRunWithRateLimit(t *testing.T) {
+	clock := graceful.NewFakeClock(time.Now())
+	limiter := graceful.NewRateLimiter(1.0/3600, 1, graceful.WithRateLimiterClock(clock))
+
+	ran := make(chan struct{}, 1)
+	var final atomic.Bool
+	runner := func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			final.Store(true)
+			return nil
+		}
+		ran <- struct{}{}
+		return nil
+	}
+	ticker := graceful.Ticker(time.Minute, runner,
+		graceful.WithTickerClock(clock),
+		graceful.WithTickerLimiter(limiter),
+		graceful.WithTickerFinalRun(time.Second),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ticker(ctx) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-ran
+
+	// the second run waits for a token, an hour away
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(2)
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.True(t, final.Load())
+}
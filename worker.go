@@ -2,6 +2,8 @@ package graceful
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
 	"github.com/rotisserie/eris"
 	"github.com/rs/zerolog"
@@ -9,8 +11,44 @@ import (
 
 var ErrWorkerFailure = eris.New("worker failure")
 
+// WorkerShutdownPolicy decides how a message whose handler failed after the
+// runner context was cancelled is settled. Messages handled successfully are
+// always acked.
+type WorkerShutdownPolicy int
+
+const (
+	// WorkerShutdownNack hands the message back to the source, so it is
+	// redelivered.
+	WorkerShutdownNack WorkerShutdownPolicy = iota
+	// WorkerShutdownAck drops the message.
+	WorkerShutdownAck
+)
+
+type WorkerTimeoutPolicy int
+
+const (
+	// WorkerTimeoutRetryable handles a timed out item like any other failed
+	// one: it is logged and nacked.
+	WorkerTimeoutRetryable WorkerTimeoutPolicy = iota
+	// WorkerTimeoutFatal stops the worker with ErrWorkerFailure.
+	WorkerTimeoutFatal
+)
+
 type worker struct {
-	logger *zerolog.Logger
+	logger          *zerolog.Logger
+	partitionBuffer int
+	shutdown        WorkerShutdownPolicy
+	maxDeliveries   int
+	redeliveryDelay time.Duration
+	breaker         *breakerConfig
+	starvationLimit int
+	autoscaler      *Autoscaler
+	dedup           *dedup
+	itemTimeout     time.Duration
+	timeoutPolicy   WorkerTimeoutPolicy
+	slowThreshold   time.Duration
+	limiter         *RateLimiter
+	clock           Clock
 }
 
 type WorkerOpt func(*worker)
@@ -23,29 +61,386 @@ func WithWorkerLogger(logger *zerolog.Logger) WorkerOpt {
 	}
 }
 
+// WithWorkerPartitionBuffer sets the per-lane buffer of PartitionedWorker.
+// Other workers ignore it.
+func WithWorkerPartitionBuffer(size int) WorkerOpt {
+	return func(w *worker) {
+		if size >= 0 {
+			w.partitionBuffer = size
+		}
+	}
+}
+
+func WithWorkerShutdownPolicy(policy WorkerShutdownPolicy) WorkerOpt {
+	return func(w *worker) {
+		w.shutdown = policy
+	}
+}
+
+// WithWorkerMaxDeliveries drops a failed message, logging it and acking it
+// instead of nacking, once its source has delivered it max times. It needs
+// messages implementing Deliveries() int, like those of MemorySource.
+// Deliveries are unlimited by default.
+func WithWorkerMaxDeliveries(max int) WorkerOpt {
+	return func(w *worker) {
+		if max > 0 {
+			w.maxDeliveries = max
+		}
+	}
+}
+
+// WithWorkerRedeliveryDelay pauses the worker after each nack, so a handler
+// that keeps failing does not spin through redeliveries.
+func WithWorkerRedeliveryDelay(delay time.Duration) WorkerOpt {
+	return func(w *worker) {
+		if delay > 0 {
+			w.redeliveryDelay = delay
+		}
+	}
+}
+
+// WithWorkerCircuitBreaker pauses the worker for openFor after threshold
+// consecutive handler failures, then retries with a single item. When the
+// breaker stays open for longer than maxOpen the worker fails with
+// ErrCircuitOpen; zero maxOpen never escalates.
+func WithWorkerCircuitBreaker(threshold int, openFor, maxOpen time.Duration) WorkerOpt {
+	return func(w *worker) {
+		if threshold > 0 && openFor > 0 {
+			w.breaker = &breakerConfig{threshold: threshold, openFor: openFor, maxOpen: maxOpen}
+		}
+	}
+}
+
+// WithWorkerStarvationLimit makes PriorityWorker give lower-priority channels
+// a turn after limit consecutive items from higher-priority ones. Other
+// workers ignore it.
+func WithWorkerStarvationLimit(limit int) WorkerOpt {
+	return func(w *worker) {
+		if limit > 0 {
+			w.starvationLimit = limit
+		}
+	}
+}
+
+// WithWorkerAutoscaler runs the worker on a number of goroutines scaled by
+// the autoscaler. Without it the worker handles one item at a time.
+func WithWorkerAutoscaler(autoscaler *Autoscaler) WorkerOpt {
+	return func(w *worker) {
+		w.autoscaler = autoscaler
+	}
+}
+
+// WithWorkerItemTimeout bounds the context each handler call receives.
+func WithWorkerItemTimeout(timeout time.Duration) WorkerOpt {
+	return func(w *worker) {
+		if timeout > 0 {
+			w.itemTimeout = timeout
+		}
+	}
+}
+
+func WithWorkerTimeoutPolicy(policy WorkerTimeoutPolicy) WorkerOpt {
+	return func(w *worker) {
+		w.timeoutPolicy = policy
+	}
+}
+
+// WithWorkerSlowThreshold logs a warning for every item still being handled
+// after threshold.
+func WithWorkerSlowThreshold(threshold time.Duration) WorkerOpt {
+	return func(w *worker) {
+		if threshold > 0 {
+			w.slowThreshold = threshold
+		}
+	}
+}
+
+// WithWorkerRateLimit limits the worker to perSecond items, with bursts of up
+// to burst items.
+func WithWorkerRateLimit(perSecond float64, burst int) WorkerOpt {
+	limiter := NewRateLimiter(perSecond, burst)
+	return func(w *worker) {
+		w.limiter = limiter
+	}
+}
+
+// WithWorkerLimiter limits the worker with a limiter that can be shared with
+// other runners.
+func WithWorkerLimiter(limiter *RateLimiter) WorkerOpt {
+	return func(w *worker) {
+		w.limiter = limiter
+	}
+}
+
+// WithWorkerClock sets the clock of the circuit breaker, timeouts, delays and
+// autoscaling of the worker.
+func WithWorkerClock(clock Clock) WorkerOpt {
+	return func(w *worker) {
+		if clock != nil {
+			w.clock = clock
+		}
+	}
+}
+
 type WorkerHandler[T any] func(context.Context, T) error
 
-func Worker[T any](ch <-chan T, runner WorkerHandler[T], opts ...WorkerOpt) Runner {
+func newWorker(opts []WorkerOpt) *worker {
 	noop := zerolog.Nop()
 	cfg := &worker{
 		logger: &noop,
+		clock:  realClock{},
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
+
+	return cfg
+}
+
+func Worker[T any](ch <-chan T, runner WorkerHandler[T], opts ...WorkerOpt) Runner {
+	return SourceWorker(ChannelSource(ch), runner, opts...)
+}
+
+func SourceWorker[T any](src Source[T], runner WorkerHandler[T], opts ...WorkerOpt) Runner {
+	cfg := newWorker(opts)
+
 	return func(ctx context.Context) error {
-		for value := range ch {
-			if err := runner(ctx, value); err != nil {
-				if eris.Is(err, ErrWorkerFailure) {
-					return err
+		state := newWorkerState(cfg)
+
+		runCtx, cancelRun := context.WithCancel(ctx)
+		defer cancelRun()
+
+		// sources that drain until closed only stop receiving on a fatal error
+		recvCtx := runCtx
+		if _, ok := src.(drainingSource); ok {
+			var cancelRecv context.CancelFunc
+			recvCtx, cancelRecv = context.WithCancel(context.WithoutCancel(ctx))
+			defer cancelRecv()
+			stop := context.AfterFunc(runCtx, func() {
+				if ctx.Err() == nil {
+					cancelRecv()
 				}
-				cfg.logger.
-					Error().
-					Any("error", eris.ToJSON(err, true)).
-					Msg("runner failed")
+			})
+			defer stop()
+		}
+
+		if cfg.autoscaler == nil {
+			return consume(runCtx, recvCtx, cfg, state, src, runner, nil)
+		}
+
+		return autoscale(runCtx, cancelRun, recvCtx, cfg, state, src, runner)
+	}
+}
+
+// consume receives and handles messages until the source is exhausted, a
+// fatal error occurs or retire reports the goroutine is no longer needed.
+func consume[T any](ctx, recvCtx context.Context, cfg *worker, state *workerState, src Source[T], runner WorkerHandler[T], retire func() bool) error {
+	for {
+		if retire != nil && retire() {
+			return nil
+		}
+		// draining sources keep the breaker and the rate limit through
+		// shutdown
+		if err := state.pause(recvCtx); err != nil {
+			return ctx.Err()
+		}
+
+		receiveCtx, cancel := recvCtx, context.CancelFunc(func() {})
+		if retire != nil {
+			// idle goroutines wake up every scale interval, so they can
+			// retire as well
+			receiveCtx, cancel = withTimeout(recvCtx, cfg.clock, cfg.autoscaler.interval)
+		}
+		msg, err := src.Receive(receiveCtx)
+		idle := err != nil && receiveCtx.Err() != nil && recvCtx.Err() == nil
+		cancel()
+		if idle {
+			continue
+		}
+		if err != nil {
+			if eris.Is(err, ErrSourceClosed) {
+				return nil
 			}
+			if recvCtx.Err() != nil {
+				return ctx.Err()
+			}
+			return eris.Wrap(err, "failed to receive message")
 		}
 
+		started := cfg.clock.Now()
+		err = handleMessage(ctx, cfg, state, runner, msg)
+		cfg.autoscaler.observe(cfg.clock.Now().Sub(started))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type workerState struct {
+	clock    Clock
+	breaker  *breaker
+	limiter  *RateLimiter
+	position atomic.Uint64
+}
+
+func newWorkerState(cfg *worker) *workerState {
+	return &workerState{
+		clock:   cfg.clock,
+		breaker: newBreaker(cfg.breaker, cfg.clock.Now),
+		limiter: cfg.limiter,
+	}
+}
+
+// pause blocks while the circuit breaker is open, then until the rate limiter
+// lets the next item through.
+func (s *workerState) pause(ctx context.Context) error {
+	for {
+		wait := s.breaker.acquire()
+		if wait == 0 {
+			break
+		}
+		if err := sleep(ctx, s.clock, wait); err != nil {
+			return err
+		}
+	}
+
+	return s.limiter.Wait(ctx)
+}
+
+type deliveryCounter interface {
+	Deliveries() int
+}
+
+func handleMessage[T any](ctx context.Context, cfg *worker, state *workerState, runner WorkerHandler[T], msg Message[T]) error {
+	id, dedup := dedupID(cfg, msg.Value())
+	if dedup {
+		fresh, err := cfg.dedup.store.Reserve(ctx, id)
+		if err != nil {
+			// better to risk a duplicate than to lose the item
+			cfg.logger.
+				Error().
+				Str("id", id).
+				Any("error", eris.ToJSON(eris.Wrap(err, "failed to reserve item"), true)).
+				Msg("dedup store failed")
+			dedup = false
+		} else if !fresh {
+			cfg.logger.
+				Info().
+				Str("id", id).
+				Msg("skipping duplicate item")
+			settleMessage(cfg, msg.Ack, "ack")
+			return nil
+		}
+	}
+
+	err := runItem(ctx, cfg, state.position.Add(1), runner, msg.Value())
+	if err != nil && dedup {
+		if err := cfg.dedup.store.Release(context.WithoutCancel(ctx), id); err != nil {
+			cfg.logger.
+				Error().
+				Str("id", id).
+				Any("error", eris.ToJSON(eris.Wrap(err, "failed to release item"), true)).
+				Msg("dedup store failed")
+		}
+	}
+
+	if err == nil {
+		state.breaker.success()
+		settleMessage(cfg, msg.Ack, "ack")
+		return nil
+	}
+
+	if eris.Is(err, ErrWorkerFailure) {
+		settleMessage(cfg, msg.Nack, "nack")
+		return err
+	}
+
+	cfg.logger.
+		Error().
+		Any("error", eris.ToJSON(err, true)).
+		Msg("runner failed")
+
+	if err := state.breaker.failure(); err != nil {
+		settleMessage(cfg, msg.Nack, "nack")
+		return err
+	}
+
+	if ctx.Err() != nil && cfg.shutdown == WorkerShutdownAck {
+		settleMessage(cfg, msg.Ack, "ack")
 		return nil
 	}
+
+	if counter, ok := msg.(deliveryCounter); ok && cfg.maxDeliveries > 0 && counter.Deliveries() >= cfg.maxDeliveries {
+		cfg.logger.
+			Error().
+			Int("deliveries", counter.Deliveries()).
+			Msg("dropping message after max deliveries")
+		settleMessage(cfg, msg.Ack, "ack")
+		return nil
+	}
+
+	settleMessage(cfg, msg.Nack, "nack")
+
+	if cfg.redeliveryDelay > 0 {
+		_ = sleep(ctx, cfg.clock, cfg.redeliveryDelay)
+	}
+
+	return nil
+}
+
+func runItem[T any](ctx context.Context, cfg *worker, position uint64, runner WorkerHandler[T], value T) error {
+	itemCtx := ctx
+	if cfg.itemTimeout > 0 {
+		var cancel context.CancelFunc
+		itemCtx, cancel = withTimeout(ctx, cfg.clock, cfg.itemTimeout)
+		defer cancel()
+	}
+
+	started := cfg.clock.Now()
+	if cfg.slowThreshold > 0 {
+		timer := cfg.clock.AfterFunc(cfg.slowThreshold, func() {
+			cfg.logger.
+				Warn().
+				Uint64("position", position).
+				Dur("elapsed", cfg.clock.Now().Sub(started)).
+				Msg("slow item")
+		})
+		defer func() {
+			if !timer.Stop() {
+				cfg.logger.
+					Warn().
+					Uint64("position", position).
+					Dur("elapsed", cfg.clock.Now().Sub(started)).
+					Msg("slow item finished")
+			}
+		}()
+	}
+
+	err := runner(itemCtx, value)
+	if err == nil || ctx.Err() != nil || !eris.Is(itemCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	if cfg.timeoutPolicy == WorkerTimeoutFatal {
+		return eris.Wrapf(ErrWorkerFailure, "item %d timed out after %s: %v", position, cfg.itemTimeout, err)
+	}
+
+	return eris.Wrapf(err, "item %d timed out after %s", position, cfg.itemTimeout)
+}
+
+func dedupID(cfg *worker, value any) (string, bool) {
+	if cfg.dedup == nil {
+		return "", false
+	}
+
+	return cfg.dedup.id(value)
+}
+
+func settleMessage(cfg *worker, settle func() error, action string) {
+	if err := settle(); err != nil {
+		cfg.logger.
+			Error().
+			Any("error", eris.ToJSON(err, true)).
+			Msgf("failed to %s message", action)
+	}
 }
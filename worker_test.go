@@ -7,6 +7,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/LiquidCats/graceful/v2"
 	"github.com/rs/zerolog"
@@ -146,3 +147,142 @@ func TestWithWorkerLogger(t *testing.T) {
 	// Verify that no logs were emitted.
 	assert.Empty(t, buf.String())
 }
+
+func TestWorkerCircuitBreakerPausesAfterFailures(t *testing.T) {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	var calls []time.Time
+	handler := func(ctx context.Context, v int) error {
+		calls = append(calls, time.Now())
+		if v < 3 {
+			return fmt.Errorf("database is down")
+		}
+		return nil
+	}
+
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerCircuitBreaker(2, 50*time.Millisecond, 0))
+	assert.NoError(t, runner(context.Background()))
+
+	assert.Len(t, calls, 3)
+	assert.GreaterOrEqual(t, calls[2].Sub(calls[1]), 50*time.Millisecond)
+}
+
+func TestWorkerCircuitBreakerEscalates(t *testing.T) {
+	ch := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(ch)
+		for i := 0; ; i++ {
+			select {
+			case ch <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	handler := func(ctx context.Context, v int) error {
+		return fmt.Errorf("database is down")
+	}
+
+	runner := graceful.Worker[int](ch, handler, graceful.WithWorkerCircuitBreaker(1, 10*time.Millisecond, 30*time.Millisecond))
+	assert.ErrorIs(t, runner(context.Background()), graceful.ErrCircuitOpen)
+}
+
+func TestWorkerItemTimeoutRetryable(t *testing.T) {
+	ch := make(chan int, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	var processed int32
+	handler := func(ctx context.Context, v int) error {
+		if v == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}
+
+	runner := graceful.Worker[int](ch, handler,
+		graceful.WithWorkerItemTimeout(10*time.Millisecond),
+		graceful.WithWorkerLogger(&logger),
+	)
+
+	assert.NoError(t, runner(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+	assert.Contains(t, buf.String(), "item 1 timed out")
+}
+
+func TestWorkerItemTimeoutFatal(t *testing.T) {
+	ch := make(chan int, 1)
+	ch <- 1
+	close(ch)
+
+	handler := func(ctx context.Context, v int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	runner := graceful.Worker[int](ch, handler,
+		graceful.WithWorkerItemTimeout(10*time.Millisecond),
+		graceful.WithWorkerTimeoutPolicy(graceful.WorkerTimeoutFatal),
+	)
+
+	assert.ErrorIs(t, runner(context.Background()), graceful.ErrWorkerFailure)
+}
+
+func TestWorkerSlowThreshold(t *testing.T) {
+	ch := make(chan int, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf)
+
+	handler := func(ctx context.Context, v int) error {
+		if v == 2 {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return nil
+	}
+
+	runner := graceful.Worker[int](ch, handler,
+		graceful.WithWorkerSlowThreshold(10*time.Millisecond),
+		graceful.WithWorkerLogger(&logger),
+	)
+
+	assert.NoError(t, runner(context.Background()))
+	assert.Contains(t, buf.String(), `"position":2`)
+	assert.Contains(t, buf.String(), "slow item finished")
+	assert.NotContains(t, buf.String(), `"position":1`)
+}
+
+// syncBuffer is a bytes.Buffer safe for loggers written from several goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}